@@ -0,0 +1,112 @@
+package align
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+	"github.com/warmans/tvgif/pkg/align"
+	"github.com/warmans/tvgif/pkg/flag"
+	"github.com/warmans/tvgif/pkg/metadata"
+	"github.com/warmans/tvgif/pkg/search"
+	"github.com/warmans/tvgif/pkg/store"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+func NewAlignCommand(logger *slog.Logger) *cobra.Command {
+
+	var mediaPath string
+	var metadataPath string
+	var varPath string
+	var indexPath string
+	var dbCfg = &store.Config{}
+	var maxOffsetSeconds int64
+
+	cmd := &cobra.Command{
+		Use:   "align [srt-file...]",
+		Short: "correct subtitle timings using the audio of the video (all SRT files in the media path if none are given)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			conn, err := store.NewConn(dbCfg)
+			if err != nil {
+				return err
+			}
+			if err := conn.Migrate(); err != nil {
+				return err
+			}
+			searcher, err := search.NewBlugeSearch(indexPath)
+			if err != nil {
+				return fmt.Errorf("failed to create searcher: %w", err)
+			}
+
+			srtFiles := args
+			if len(srtFiles) == 0 {
+				dirEntries, err := os.ReadDir(mediaPath)
+				if err != nil {
+					return err
+				}
+				for _, v := range dirEntries {
+					if strings.HasSuffix(v.Name(), ".srt") {
+						srtFiles = append(srtFiles, v.Name())
+					}
+				}
+			}
+
+			aligner := align.NewAligner(logger, time.Duration(maxOffsetSeconds)*time.Second)
+			failed := 0
+			for _, srtFile := range srtFiles {
+				// metadata is always re-created from the SRT, so the alignment is never applied twice.
+				meta, err := metadata.CreateMetadataFromSRT(path.Join(mediaPath, path.Base(srtFile)), metadataPath, varPath, logger)
+				if err != nil {
+					return fmt.Errorf("failed to create metadata: %w", err)
+				}
+				logger := logger.With(slog.String("episode_id", meta.ID()))
+
+				meta.Dialog, meta.Alignment, err = aligner.Align(ctx, path.Join(mediaPath, meta.VideoFile), meta.Dialog)
+				if err != nil {
+					logger.Error("Failed to align episode", slog.String("err", err.Error()))
+					failed++
+					continue
+				}
+				// like the importer, any manual offset is applied on top of the alignment.
+				offset, err := store.NewSRTStore(conn.Db).GetEpisodeOffset(meta.Publication, meta.Series, meta.Episode)
+				if err != nil {
+					return fmt.Errorf("failed to get episode offset: %w", err)
+				}
+				if !offset.IsZero() {
+					meta.Dialog, meta.Offset = offset.Apply(meta.Dialog), &offset
+				}
+				if err := metadata.SaveMetadata(metadataPath, meta); err != nil {
+					return err
+				}
+				if err := conn.WithTx(func(tx *sqlx.Tx) error {
+					return store.NewSRTStore(tx).ImportEpisode(*meta)
+				}); err != nil {
+					return fmt.Errorf("failed to update dialog: %w", err)
+				}
+				if err := searcher.Import(ctx, meta, true); err != nil {
+					return fmt.Errorf("failed to update index: %w", err)
+				}
+			}
+			if err := searcher.RefreshIndex(); err != nil {
+				return err
+			}
+			logger.Info("Alignment complete", slog.Int("episodes", len(srtFiles)), slog.Int("failed", failed))
+			return nil
+		},
+	}
+
+	flag.StringVarEnv(cmd.Flags(), &mediaPath, "", "media-path", "./var/media", "path to media files")
+	flag.StringVarEnv(cmd.Flags(), &metadataPath, "", "metadata-path", "./var/metadata", "path to metadata files")
+	flag.StringVarEnv(cmd.Flags(), &varPath, "", "var-path", "./var", "path to var dir")
+	flag.StringVarEnv(cmd.Flags(), &indexPath, "", "index-path", "./var/index/metadata.bluge", "path to index files")
+	flag.Int64VarEnv(cmd.Flags(), &maxOffsetSeconds, "", "align-max-offset-seconds", 60, "largest offset between the subtitles and audio to search for")
+	dbCfg.RegisterFlags(cmd.Flags(), "", "dialog")
+
+	return cmd
+}
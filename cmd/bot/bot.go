@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/bwmarrin/discordgo"
 	"github.com/spf13/cobra"
+	"github.com/warmans/tvgif/pkg/align"
 	"github.com/warmans/tvgif/pkg/discord"
 	"github.com/warmans/tvgif/pkg/docs"
 	"github.com/warmans/tvgif/pkg/flag"
@@ -13,18 +14,23 @@ import (
 	"github.com/warmans/tvgif/pkg/render"
 	"github.com/warmans/tvgif/pkg/search"
 	"github.com/warmans/tvgif/pkg/store"
+	"github.com/warmans/tvgif/pkg/util"
 	"github.com/warmans/tvgif/pkg/web"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"path"
+	"time"
 )
 
 func NewBotCommand(logger *slog.Logger) *cobra.Command {
 
 	var mediaPath string
 	var cachePath string
+	var cacheMaxSizeMB int64
+	var s3Cfg = &mediacache.S3Config{}
 	var discordToken string
 	var botUsername string
 
@@ -33,6 +39,13 @@ func NewBotCommand(logger *slog.Logger) *cobra.Command {
 	var dbCfg = &store.Config{}
 	var metadataPath string
 	var varPath string
+	var trustedRoleIDs string
+	var renderWorkerURLs string
+	var renderWorkerToken string
+	var warmTopN int64
+	var alignSubs bool
+	var alignMaxOffsetSeconds int64
+	var subsLanguage string
 
 	cmd := &cobra.Command{
 		Use:   "bot",
@@ -62,6 +75,10 @@ func NewBotCommand(logger *slog.Logger) *cobra.Command {
 				return fmt.Errorf("failed to create searcher: %w", err)
 			}
 
+			var aligner *align.Aligner
+			if alignSubs {
+				aligner = align.NewAligner(logger, time.Duration(alignMaxOffsetSeconds)*time.Second)
+			}
 			importWorker := importer.NewIncrementalImporter(
 				mediaPath,
 				metadataPath,
@@ -70,6 +87,8 @@ func NewBotCommand(logger *slog.Logger) *cobra.Command {
 				searcher,
 				logger,
 				useFilePolling,
+				aligner,
+				subsLanguage,
 			)
 			go func() {
 				if err := importWorker.Start(ctx); err != nil {
@@ -86,14 +105,36 @@ func NewBotCommand(logger *slog.Logger) *cobra.Command {
 				return fmt.Errorf("failed to create discord session: %w", err)
 			}
 
-			if cachePath == "" {
-				logger.Info("No cache dir specified, using OS temp dir")
-				cachePath = os.TempDir()
+			var cacheStorage mediacache.Storage
+			var cacheOpts []mediacache.CacheOption
+			if s3Cfg.Enabled() {
+				// S3 objects can't be touched and the bucket is shared so there's no way to know which are least
+				// recently used. A lifecycle rule should be used to expire them instead.
+				logger.Info("Using S3 cache storage, cache size limit is disabled", slog.String("endpoint", s3Cfg.Endpoint), slog.String("bucket", s3Cfg.Bucket))
+				cacheStorage, err = mediacache.NewS3Storage(*s3Cfg)
+				if err != nil {
+					return fmt.Errorf("failed to create S3 cache storage: %w", err)
+				}
+			} else {
+				cacheOpts = append(cacheOpts, mediacache.WithMaxSize(cacheMaxSizeMB*1024*1024))
+				if cachePath == "" {
+					// a sub-dir is needed as files in the cache dir are subject to eviction.
+					cachePath = path.Join(os.TempDir(), "tvgif-cache")
+					logger.Info("No cache dir specified, using OS temp dir", slog.String("path", cachePath))
+					if err := os.MkdirAll(cachePath, 0755); err != nil {
+						return fmt.Errorf("failed to create cache dir: %w", err)
+					}
+				}
+				cacheStorage, err = mediacache.NewFilesystemStorage(cachePath, logger)
+				if err != nil {
+					return fmt.Errorf("failed to create cache storage: %w", err)
+				}
 			}
-			mediaCache, err := mediacache.NewCache(cachePath, logger)
+			mediaCache, err := mediacache.NewCache(cacheStorage, logger, cacheOpts...)
 			if err != nil {
 				return fmt.Errorf("failed to create media cache: %w", err)
 			}
+			go mediaCache.Run(ctx)
 
 			if mediaPath == "" {
 				return fmt.Errorf("no media dir specified")
@@ -108,27 +149,50 @@ func NewBotCommand(logger *slog.Logger) *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("failed to create overlay cache")
 			}
+			go func() {
+				if err := overlayCache.Watch(ctx); err != nil {
+					logger.Error("overlay watcher failed", slog.String("err", err.Error()))
+				}
+			}()
+
+			var executor render.Executor = render.NewLocalExecutor(mediaPath, logger)
+			if workerURLs := util.SplitNonEmpty(renderWorkerURLs, ","); len(workerURLs) > 0 {
+				if renderWorkerToken == "" {
+					return fmt.Errorf("render-worker-token is required when using render workers")
+				}
+				logger.Info("Using remote render workers", slog.String("urls", renderWorkerURLs))
+				pool, err := render.NewPoolExecutor(workerURLs, renderWorkerToken, &http.Client{}, logger)
+				if err != nil {
+					return fmt.Errorf("failed to create render worker pool: %w", err)
+				}
+				go pool.Run(ctx)
+				executor = pool
+			}
 
 			logger.Info("Starting bot...")
 			bot, err := discord.NewBot(
 				logger,
 				session,
 				searcher,
-				render.NewExecRenderer(mediaCache, mediaPath, logger, overlayCache),
+				render.NewExecRenderer(mediaCache, logger, overlayCache, executor),
 				botUsername,
-				store.NewSRTStore(conn.Db),
+				conn,
 				docsRepo,
 				overlayCache,
+				util.SplitNonEmpty(trustedRoleIDs, ","),
 			)
 			if err != nil {
 				return fmt.Errorf("failed to create bot: %w", err)
 			}
 
-			server := web.NewServer(":8080", path.Join(mediaPath, "overlay"), overlayCache)
+			server := web.NewServer(":8080", path.Join(mediaPath, "overlay"), overlayCache, mediaCache)
 
 			if err = bot.Start(); err != nil {
 				return fmt.Errorf("failed to start bot: %w", err)
 			}
+			if warmTopN > 0 {
+				go bot.WarmCache(ctx, int(warmTopN))
+			}
 
 			go func() {
 				logger.Info("Starting web server", slog.String("addr", ":8080"))
@@ -152,14 +216,23 @@ func NewBotCommand(logger *slog.Logger) *cobra.Command {
 	flag.StringVarEnv(cmd.Flags(), &mediaPath, "", "media-path", "./var/media", "path to media files")
 	flag.StringVarEnv(cmd.Flags(), &discordToken, "", "discord-token", "", "discord auth token")
 	flag.StringVarEnv(cmd.Flags(), &cachePath, "", "cache-path", "", "path to cache dir")
+	flag.Int64VarEnv(cmd.Flags(), &cacheMaxSizeMB, "", "cache-max-size-mb", 5000, "least recently used files will be removed from the cache dir once it exceeds this size (0 for unlimited, ignored for S3)")
 	flag.StringVarEnv(cmd.Flags(), &botUsername, "", "bot-username", "tvgif", "bot username and differentiator, used to determine if a message belongs to the bot e.g. tvgif#213")
 
 	flag.BoolVarEnv(cmd.Flags(), &useFilePolling, "", "use-file-polling", true, "instead of relying on filesystem events just poll for changes")
+	flag.BoolVarEnv(cmd.Flags(), &alignSubs, "", "align-subs", false, "correct subtitle timings using the audio of the video when importing")
+	flag.Int64VarEnv(cmd.Flags(), &alignMaxOffsetSeconds, "", "align-max-offset-seconds", 60, "largest offset between the subtitles and audio to search for")
+	flag.StringVarEnv(cmd.Flags(), &subsLanguage, "", "extract-subs-language", "eng", "extract subtitles in this language from videos with no SRT (empty to disable)")
 	flag.StringVarEnv(cmd.Flags(), &indexPath, "", "index-path", "./var/index/metadata.bluge", "path to index files")
 	flag.StringVarEnv(cmd.Flags(), &metadataPath, "", "metadata-path", "./var/metadata", "path to metadata files")
 	flag.StringVarEnv(cmd.Flags(), &varPath, "", "var-path", "./var", "path to var dir")
+	flag.StringVarEnv(cmd.Flags(), &renderWorkerURLs, "", "render-worker-urls", "", "comma separated render worker URLs to run ffmpeg on instead of locally e.g. http://worker-1:8081,http://worker-2:8081")
+	flag.StringVarEnv(cmd.Flags(), &renderWorkerToken, "", "render-worker-token", "", "shared secret sent to render workers (must match the workers' token)")
+	flag.Int64VarEnv(cmd.Flags(), &warmTopN, "", "warm-top-n", 20, "pre-render this many of the most requested clips while the bot is idle (0 to disable)")
+	flag.StringVarEnv(cmd.Flags(), &trustedRoleIDs, "", "trusted-role-ids", "", "comma separated discord role IDs allowed to use admin commands e.g. uploading overlays")
 
 	dbCfg.RegisterFlags(cmd.Flags(), "", "dialog")
+	s3Cfg.RegisterFlags(cmd.Flags(), "")
 	flag.Parse()
 
 	return cmd
@@ -0,0 +1,68 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/warmans/tvgif/pkg/flag"
+	"github.com/warmans/tvgif/pkg/ingest"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path"
+	"time"
+)
+
+func NewIngestCommand(logger *slog.Logger) *cobra.Command {
+
+	var cfg = ingest.Config{}
+	var width, height, fps int64
+	var varPath string
+	var pollIntervalSeconds int64
+	var once bool
+
+	cmd := &cobra.Command{
+		Use:   "ingest",
+		Short: "rename, transcode and extract subtitles from videos in the inbox dir then move them to the media dir",
+		Long: "Videos should be put in a sub-dir of the inbox named after the publication e.g. inbox/peepshow/Peep Show S01E01.mkv. " +
+			"An SRT with the same name as the video will be used if it exists, otherwise subtitles are extracted from the video. " +
+			"Processed files are moved to inbox/.processed.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			if cfg.InboxDir == "" || cfg.MediaDir == "" {
+				return fmt.Errorf("inbox and media dirs must be specified")
+			}
+			if width <= 0 || height <= 0 || fps <= 0 {
+				return fmt.Errorf("width, height and fps must be greater than 0")
+			}
+			cfg.Width, cfg.Height, cfg.FPS = int(width), int(height), int(fps)
+
+			jobLog, err := ingest.OpenJobLog(path.Join(varPath, "ingest-jobs.jsonl"))
+			if err != nil {
+				return fmt.Errorf("failed to open job log: %w", err)
+			}
+			ingester := ingest.NewIngester(cfg, jobLog, logger)
+			if once {
+				return ingester.ProcessInbox(ctx)
+			}
+			logger.Info("Watching inbox", slog.String("path", cfg.InboxDir))
+			return ingester.Run(ctx, time.Duration(pollIntervalSeconds)*time.Second)
+		},
+	}
+
+	flag.StringVarEnv(cmd.Flags(), &cfg.InboxDir, "", "inbox-path", "./var/inbox", "path to the dir to ingest files from")
+	flag.StringVarEnv(cmd.Flags(), &cfg.MediaDir, "", "media-path", "./var/media", "path to media files")
+	flag.StringVarEnv(cmd.Flags(), &varPath, "", "var-path", "./var", "path to var dir (the job log is stored here)")
+	flag.StringVarEnv(cmd.Flags(), &cfg.DefaultPublication, "", "ingest-publication", "", "publication to use for files in the root of the inbox")
+	flag.Int64VarEnv(cmd.Flags(), &width, "", "ingest-width", 596, "width of transcoded videos")
+	flag.Int64VarEnv(cmd.Flags(), &height, "", "ingest-height", 336, "height of transcoded videos, videos with a different aspect ratio are padded")
+	flag.Int64VarEnv(cmd.Flags(), &fps, "", "ingest-fps", 10, "framerate of transcoded videos")
+	flag.BoolVarEnv(cmd.Flags(), &cfg.KeepAudio, "", "ingest-keep-audio", false, "keep the audio (required for subtitle alignment)")
+	flag.StringVarEnv(cmd.Flags(), &cfg.SubsLanguage, "", "extract-subs-language", "eng", "extract subtitles in this language from videos with no SRT")
+	flag.Int64VarEnv(cmd.Flags(), &pollIntervalSeconds, "", "ingest-poll-interval-seconds", 30, "how often to check the inbox for new files")
+	cmd.Flags().BoolVar(&once, "once", false, "process the inbox once and exit instead of watching it")
+
+	return cmd
+}
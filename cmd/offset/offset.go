@@ -0,0 +1,133 @@
+package offset
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/warmans/tvgif/pkg/model"
+	"github.com/warmans/tvgif/pkg/store"
+	"github.com/warmans/tvgif/pkg/util"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func NewOffsetCommand(logger *slog.Logger) *cobra.Command {
+
+	var dbCfg = &store.Config{}
+
+	cmd := &cobra.Command{
+		Use:   "offset",
+		Short: "manage per-episode subtitle timing corrections",
+	}
+
+	dbCfg.RegisterFlags(cmd.PersistentFlags(), "", "dialog")
+
+	cmd.AddCommand(NewSetCommand(logger, dbCfg))
+	cmd.AddCommand(NewRemoveCommand(dbCfg))
+	cmd.AddCommand(NewListCommand(dbCfg))
+
+	return cmd
+}
+
+func NewSetCommand(logger *slog.Logger, dbCfg *store.Config) *cobra.Command {
+	var scale float64
+	cmd := &cobra.Command{
+		Use:     "set [episode-id] [offset]",
+		Short:   "set an offset (e.g. 1.2s or -500ms) to add to all the episode's subtitles",
+		Example: "tvgif offset set peepshow-S02E05 1.2s",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			publication, series, episode, err := parseEpisodeID(args[0])
+			if err != nil {
+				return err
+			}
+			offset, err := time.ParseDuration(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid offset %s: %w", args[1], err)
+			}
+			if scale <= 0 {
+				return fmt.Errorf("scale must be greater than 0")
+			}
+			srtStore, err := openStore(dbCfg)
+			if err != nil {
+				return err
+			}
+			if err := srtStore.SetEpisodeOffset(model.EpisodeOffset{
+				Publication: publication,
+				Series:      series,
+				Episode:     episode,
+				Offset:      offset,
+				Scale:       scale,
+			}); err != nil {
+				return err
+			}
+			logger.Info("Offset set, the episode will be re-imported by the bot", slog.String("episode_id", args[0]), slog.Duration("offset", offset), slog.Float64("scale", scale))
+			return nil
+		},
+	}
+	cmd.Flags().Float64Var(&scale, "scale", 1, "multiply all timestamps by this before adding the offset e.g. 1.0427 for subs timed against a 25fps release")
+	return cmd
+}
+
+func NewRemoveCommand(dbCfg *store.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove [episode-id]",
+		Short: "remove the episode's offset",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			publication, series, episode, err := parseEpisodeID(args[0])
+			if err != nil {
+				return err
+			}
+			srtStore, err := openStore(dbCfg)
+			if err != nil {
+				return err
+			}
+			return srtStore.RemoveEpisodeOffset(publication, series, episode)
+		},
+	}
+}
+
+func NewListCommand(dbCfg *store.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "list all episode offsets",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			srtStore, err := openStore(dbCfg)
+			if err != nil {
+				return err
+			}
+			offsets, err := srtStore.ListEpisodeOffsets()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "EPISODE\tOFFSET\tSCALE")
+			for _, v := range offsets {
+				fmt.Fprintf(w, "%s\t%s\t%g\n", v.EpisodeID(), v.Offset, v.Scale)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func openStore(dbCfg *store.Config) (*store.SRTStore, error) {
+	conn, err := store.NewConn(dbCfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Migrate(); err != nil {
+		return nil, err
+	}
+	return store.NewSRTStore(conn.Db), nil
+}
+
+// parseEpisodeID e.g. peepshow-S02E05 or the-italian-job for a film
+func parseEpisodeID(raw string) (string, int32, int32, error) {
+	publication, series, episode, err := util.ParseEpisodeID(raw)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid episode ID %s: %w", raw, err)
+	}
+	return publication, series, episode, nil
+}
@@ -3,8 +3,12 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 	transcribe "github.com/warmans/tvgif/cmd/aisrt"
+	"github.com/warmans/tvgif/cmd/align"
 	"github.com/warmans/tvgif/cmd/bot"
+	"github.com/warmans/tvgif/cmd/ingest"
+	"github.com/warmans/tvgif/cmd/offset"
 	"github.com/warmans/tvgif/cmd/tools"
+	"github.com/warmans/tvgif/cmd/worker"
 	"log/slog"
 )
 
@@ -24,5 +28,9 @@ func Execute(logger *slog.Logger) error {
 	rootCmd.AddCommand(bot.NewBotCommand(logger))
 	rootCmd.AddCommand(tools.NewToolsCommand(logger))
 	rootCmd.AddCommand(transcribe.NewRootCommand(logger))
+	rootCmd.AddCommand(worker.NewRenderWorkerCommand(logger))
+	rootCmd.AddCommand(align.NewAlignCommand(logger))
+	rootCmd.AddCommand(offset.NewOffsetCommand(logger))
+	rootCmd.AddCommand(ingest.NewIngestCommand(logger))
 	return rootCmd.Execute()
 }
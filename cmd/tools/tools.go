@@ -7,7 +7,6 @@ import (
 	"io"
 	"log/slog"
 	"os"
-	"regexp"
 	"strings"
 )
 
@@ -41,26 +40,16 @@ func NewFixNameCommand() *cobra.Command {
 			}
 
 			strName := strings.TrimSpace(string(rawName))
-			for _, re := range []*regexp.Regexp{
-				util.NameWithShortSeasonAndEpisode,
-				util.NameWithLongSeasonAndEpisode,
-				util.NameWithSplitSeasonAndEpisode,
-				util.ShortSeasonAndEpisode,
-			} {
-				if re.MatchString(strName) {
-					series, episode, err := util.ParseSeriesAndEpisodeFromFileName(re, strName)
-					if err != nil {
-						return err
-					}
-					fixedName := fmt.Sprintf("S%02dE%02d", series, episode)
-					if fixedName == strName {
-						return fmt.Errorf("rename was a noop")
-					}
-					_, err = fmt.Fprintf(os.Stdout, "%s\n", fixedName)
-					return err
-				}
+			series, episode, err := util.ParseSeriesAndEpisodeFromAnyFileName(strName)
+			if err != nil {
+				return err
+			}
+			fixedName := fmt.Sprintf("S%02dE%02d", series, episode)
+			if fixedName == strName {
+				return fmt.Errorf("rename was a noop")
 			}
-			return fmt.Errorf("no regex matched: %s", strName)
+			_, err = fmt.Fprintf(os.Stdout, "%s\n", fixedName)
+			return err
 		},
 	}
 
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/warmans/tvgif/pkg/flag"
+	"github.com/warmans/tvgif/pkg/render"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func NewRenderWorkerCommand(logger *slog.Logger) *cobra.Command {
+
+	var mediaPath string
+	var listenAddr string
+	var token string
+
+	cmd := &cobra.Command{
+		Use:   "render-worker",
+		Short: "run ffmpeg commands on behalf of a bot (see --render-worker-urls)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if mediaPath == "" {
+				return fmt.Errorf("no media dir specified")
+			}
+			if token == "" {
+				return fmt.Errorf("a render worker token must be specified")
+			}
+			executor := render.NewLocalExecutor(mediaPath, logger)
+			if err := executor.Healthy(); err != nil {
+				return fmt.Errorf("worker is not able to render: %w", err)
+			}
+
+			server := &http.Server{
+				Addr:    listenAddr,
+				Handler: render.NewWorkerHandler(executor, executor.Healthy, token, logger),
+			}
+			go func() {
+				logger.Info("Starting render worker", slog.String("addr", listenAddr))
+				if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					logger.Error("render worker failed", slog.String("err", err.Error()))
+				}
+			}()
+
+			stop := make(chan os.Signal, 1)
+			signal.Notify(stop, os.Interrupt)
+			<-stop
+
+			logger.Info("Gracefully shutting down")
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			return server.Shutdown(ctx)
+		},
+	}
+
+	flag.StringVarEnv(cmd.Flags(), &mediaPath, "", "media-path", "./var/media", "path to media files")
+	flag.StringVarEnv(cmd.Flags(), &listenAddr, "", "listen-addr", "127.0.0.1:8081", "address the worker API will listen on (only expose it to the bot's network)")
+	flag.StringVarEnv(cmd.Flags(), &token, "", "render-worker-token", "", "shared secret the bot must send with each command")
+
+	return cmd
+}
@@ -0,0 +1,309 @@
+package align
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/warmans/tvgif/pkg/model"
+	"io"
+	"log/slog"
+	"math"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// window is the resolution of the voice activity and therefore the alignment.
+const window = time.Millisecond * 100
+
+const sampleRate = 8000
+
+const samplesPerWindow = int(sampleRate * window / time.Second)
+
+// numSegments is how many parts the episode is split into to measure drift.
+const numSegments = 4
+
+// minSegmentLines is the minimum amount of dialog a segment must have to be used for measuring drift.
+const minSegmentLines = 10
+
+// maxDrift is the largest drift that will be accepted from the segment offsets.
+const maxDrift = 0.02
+
+// frameRateRatios are the common frame rate conversions that cause subtitles to drift e.g. subtitles timed
+// against a PAL (25fps) release used with a film (23.976fps) release.
+var frameRateRatios = []float64{1, 25 / 23.976, 23.976 / 25, 25.0 / 24, 24.0 / 25}
+
+// maxSegmentError is how far a segment's offset may be from the fitted line before the drift is assumed to be wrong.
+const maxSegmentError = time.Second
+
+// minCorrelation is the lowest correlation between the subtitles and the audio that will be accepted.
+const minCorrelation = 0.1
+
+var ErrNoMatch = errors.New("subtitles did not match the audio")
+
+func NewAligner(logger *slog.Logger, maxOffset time.Duration) *Aligner {
+	return &Aligner{logger: logger, maxOffset: maxOffset}
+}
+
+// Aligner corrects subtitle timings by comparing them to the voice activity in the audio of the video.
+type Aligner struct {
+	logger    *slog.Logger
+	maxOffset time.Duration
+}
+
+// Align returns the dialog with corrected timestamps and the correction that was applied.
+func (a *Aligner) Align(ctx context.Context, videoPath string, dialog []model.Dialog) ([]model.Dialog, *model.Alignment, error) {
+	if len(dialog) == 0 {
+		return dialog, nil, nil
+	}
+	activity, err := ExtractVoiceActivity(ctx, videoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	alignment, err := Compute(dialog, activity, a.maxOffset)
+	if err != nil {
+		return nil, nil, err
+	}
+	a.logger.Info(
+		"Computed subtitle alignment",
+		slog.String("video", videoPath),
+		slog.Duration("offset", alignment.Offset),
+		slog.Float64("drift", alignment.Drift),
+	)
+	return Apply(dialog, *alignment), alignment, nil
+}
+
+// ExtractVoiceActivity decodes the audio of the video and returns whether there was speech in each window.
+func ExtractVoiceActivity(ctx context.Context, videoPath string) ([]bool, error) {
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		"-nostdin",
+		"-v", "error",
+		"-i", videoPath,
+		"-vn",
+		"-ac", "1",
+		"-ar", fmt.Sprintf("%d", sampleRate),
+		// speech is mostly within this range so this reduces the influence of music and effects.
+		"-af", "highpass=f=300,lowpass=f=3000",
+		"-f", "s16le",
+		"pipe:1",
+	)
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	energy, readErr := readEnergy(bufio.NewReader(stdout))
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read audio: %w", readErr)
+	}
+	return voiceActivity(energy), nil
+}
+
+// readEnergy calculates the RMS of each window of 16 bit mono PCM.
+func readEnergy(r io.Reader) ([]float64, error) {
+	energy := []float64{}
+	buff := make([]int16, samplesPerWindow)
+	for {
+		if err := binary.Read(r, binary.LittleEndian, buff); err != nil {
+			// a partial window at the end is dropped
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return energy, nil
+			}
+			return nil, err
+		}
+		sum := 0.0
+		for _, v := range buff {
+			sum += float64(v) * float64(v)
+		}
+		energy = append(energy, math.Sqrt(sum/float64(len(buff))))
+	}
+}
+
+// voiceActivity marks windows as active if they are significantly louder than the background noise.
+func voiceActivity(energy []float64) []bool {
+	if len(energy) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(energy)
+	slices.Sort(sorted)
+	noise := sorted[len(sorted)/10]
+	loud := sorted[len(sorted)*9/10]
+	threshold := noise + (loud-noise)*0.25
+
+	activity := make([]bool, len(energy))
+	for k, v := range energy {
+		activity[k] = v > threshold
+	}
+	return activity
+}
+
+// Compute finds the offset and drift that best match the dialog to the voice activity. Each of the common
+// frame rate conversions is tried in case the subtitles were timed against a different version of the video.
+func Compute(dialog []model.Dialog, activity []bool, maxOffset time.Duration) (*model.Alignment, error) {
+	var best *model.Alignment
+	bestCorrelation := math.Inf(-1)
+	for _, ratio := range frameRateRatios {
+		scaled := Apply(dialog, model.Alignment{Drift: ratio - 1})
+		alignment, err := computeOffsetAndDrift(scaled, activity, maxOffset)
+		if err != nil {
+			continue
+		}
+		// the drift is applied after the ratio: t*ratio*(1+drift) + offset
+		alignment.Drift = ratio*(1+alignment.Drift) - 1
+
+		aligned := subtitleActivity(Apply(dialog, *alignment))
+		if correlation := correlate(aligned, activity, 0, len(aligned), 0); correlation > bestCorrelation {
+			best, bestCorrelation = alignment, correlation
+		}
+	}
+	if best == nil || bestCorrelation < minCorrelation {
+		return nil, fmt.Errorf("%w (correlation %0.2f)", ErrNoMatch, max(bestCorrelation, 0))
+	}
+	return best, nil
+}
+
+// computeOffsetAndDrift measures the offset for several segments of the episode and fits a line to get
+// the drift. If the segments don't agree the offset for the whole episode is used instead.
+func computeOffsetAndDrift(dialog []model.Dialog, activity []bool, maxOffset time.Duration) (*model.Alignment, error) {
+	subs := subtitleActivity(dialog)
+	maxShift := int(maxOffset / window)
+
+	var centers, offsets []float64
+	start, end := dialog[0].StartTimestamp, dialog[len(dialog)-1].EndTimestamp
+	segmentLength := (end - start) / numSegments
+	for k := range numSegments {
+		segStart, segEnd := start+segmentLength*time.Duration(k), start+segmentLength*time.Duration(k+1)
+		lines := 0
+		for _, d := range dialog {
+			if d.StartTimestamp >= segStart && d.StartTimestamp < segEnd {
+				lines++
+			}
+		}
+		if lines < minSegmentLines {
+			continue
+		}
+		shift, correlation := bestShift(subs, activity, int(segStart/window), int(segEnd/window), maxShift)
+		if correlation < minCorrelation {
+			continue
+		}
+		centers = append(centers, float64(segStart+segmentLength/2))
+		offsets = append(offsets, float64(time.Duration(shift)*window))
+	}
+	if len(centers) >= 2 {
+		offset, drift := fitLine(centers, offsets)
+		if math.Abs(drift) <= maxDrift && maxResidual(centers, offsets, offset, drift) <= float64(maxSegmentError) {
+			return &model.Alignment{
+				Offset: time.Duration(math.Round(offset/float64(time.Millisecond))) * time.Millisecond,
+				Drift:  drift,
+			}, nil
+		}
+	}
+
+	shift, correlation := bestShift(subs, activity, 0, len(subs), maxShift)
+	if correlation < minCorrelation {
+		return nil, ErrNoMatch
+	}
+	return &model.Alignment{Offset: time.Duration(shift) * window}, nil
+}
+
+// Apply corrects the dialog timestamps.
+func Apply(dialog []model.Dialog, alignment model.Alignment) []model.Dialog {
+	corrected := make([]model.Dialog, len(dialog))
+	for k, v := range dialog {
+		v.StartTimestamp = max(alignment.Apply(v.StartTimestamp), 0)
+		v.EndTimestamp = max(alignment.Apply(v.EndTimestamp), v.StartTimestamp)
+		corrected[k] = v
+	}
+	return corrected
+}
+
+// subtitleActivity marks each window that has dialog.
+func subtitleActivity(dialog []model.Dialog) []bool {
+	subs := make([]bool, int(dialog[len(dialog)-1].EndTimestamp/window)+1)
+	for _, d := range dialog {
+		for k := int(d.StartTimestamp / window); k < int(d.EndTimestamp/window) && k < len(subs); k++ {
+			subs[k] = true
+		}
+	}
+	return subs
+}
+
+// bestShift finds the shift (in windows) within ±maxShift that gives the highest correlation between
+// subs[from:to] and the activity.
+func bestShift(subs []bool, activity []bool, from int, to int, maxShift int) (int, float64) {
+	best, bestCorrelation := 0, math.Inf(-1)
+	for shift := -maxShift; shift <= maxShift; shift++ {
+		c := correlate(subs, activity, from, to, shift)
+		// prefer the smallest shift if there are several equally good options.
+		if c > bestCorrelation || (c == bestCorrelation && abs(shift) < abs(best)) {
+			best, bestCorrelation = shift, c
+		}
+	}
+	return best, bestCorrelation
+}
+
+// correlate calculates the phi coefficient of subs[k] and activity[k+shift].
+func correlate(subs []bool, activity []bool, from int, to int, shift int) float64 {
+	var n, nSubs, nActive, nBoth float64
+	for k := max(from, -shift); k < to && k < len(subs) && k+shift < len(activity); k++ {
+		s, a := subs[k], activity[k+shift]
+		n++
+		if s {
+			nSubs++
+		}
+		if a {
+			nActive++
+		}
+		if s && a {
+			nBoth++
+		}
+	}
+	denominator := math.Sqrt(nSubs * (n - nSubs) * nActive * (n - nActive))
+	if denominator == 0 {
+		return 0
+	}
+	return (n*nBoth - nSubs*nActive) / denominator
+}
+
+// fitLine returns the intercept and slope of the least squares line through the points.
+func fitLine(x []float64, y []float64) (float64, float64) {
+	var sumX, sumY, sumXY, sumXX float64
+	for k := range x {
+		sumX += x[k]
+		sumY += y[k]
+		sumXY += x[k] * y[k]
+		sumXX += x[k] * x[k]
+	}
+	n := float64(len(x))
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	return (sumY - slope*sumX) / n, slope
+}
+
+// maxResidual gets the largest distance of any point from the line.
+func maxResidual(x []float64, y []float64, intercept float64, slope float64) float64 {
+	residual := 0.0
+	for k := range x {
+		residual = max(residual, math.Abs(y[k]-(intercept+slope*x[k])))
+	}
+	return residual
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
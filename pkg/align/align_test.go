@@ -0,0 +1,92 @@
+package align
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/warmans/tvgif/pkg/model"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// testDialog creates lines of random length with random gaps over 20 minutes.
+func testDialog(rnd *rand.Rand) []model.Dialog {
+	dialog := []model.Dialog{}
+	ts := time.Second * 5
+	for pos := int64(1); ts < time.Minute*20; pos++ {
+		length := time.Millisecond * time.Duration(500+rnd.Intn(3000))
+		dialog = append(dialog, model.Dialog{Pos: pos, StartTimestamp: ts, EndTimestamp: ts + length})
+		ts += length + time.Millisecond*time.Duration(200+rnd.Intn(4000))
+	}
+	return dialog
+}
+
+// testActivity simulates the voice activity of a video the dialog is misaligned with. Some windows are
+// flipped to simulate background noise.
+func testActivity(rnd *rand.Rand, dialog []model.Dialog, actual model.Alignment) []bool {
+	activity := make([]bool, int(time.Minute*25/window))
+	for _, d := range Apply(dialog, actual) {
+		for k := int(d.StartTimestamp / window); k < int(d.EndTimestamp/window); k++ {
+			activity[k] = true
+		}
+	}
+	for k := range activity {
+		if rnd.Float64() < 0.1 {
+			activity[k] = !activity[k]
+		}
+	}
+	return activity
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name   string
+		actual model.Alignment
+	}{
+		{name: "aligned", actual: model.Alignment{}},
+		{name: "late", actual: model.Alignment{Offset: time.Millisecond * 1500}},
+		{name: "early", actual: model.Alignment{Offset: -time.Second * 3}},
+		{name: "drift", actual: model.Alignment{Offset: time.Second, Drift: 0.01}},
+		{name: "pal speed-up", actual: model.Alignment{Offset: -time.Millisecond * 500, Drift: 23.976/25 - 1}},
+		{name: "pal speed-up with drift", actual: model.Alignment{Offset: time.Second * 2, Drift: 25/23.976*1.002 - 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+			dialog := testDialog(rnd)
+
+			got, err := Compute(dialog, testActivity(rnd, dialog, tt.actual), time.Second*30)
+			require.NoError(t, err)
+			require.InDelta(t, tt.actual.Offset, got.Offset, float64(window*2))
+			require.InDelta(t, tt.actual.Drift, got.Drift, 0.001)
+		})
+	}
+}
+
+func TestCompute_NoMatch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	dialog := testDialog(rnd)
+
+	activity := make([]bool, int(time.Minute*25/window))
+	for k := range activity {
+		activity[k] = rnd.Float64() < 0.5
+	}
+	_, err := Compute(dialog, activity, time.Second*10)
+	require.ErrorIs(t, err, ErrNoMatch)
+}
+
+func TestApply(t *testing.T) {
+	dialog := []model.Dialog{
+		{Pos: 1, StartTimestamp: time.Second, EndTimestamp: time.Second * 2},
+		{Pos: 2, StartTimestamp: time.Second * 100, EndTimestamp: time.Second * 102},
+	}
+	got := Apply(dialog, model.Alignment{Offset: -time.Millisecond * 1500, Drift: 0.01})
+
+	// negative timestamps are clamped
+	require.Equal(t, time.Duration(0), got[0].StartTimestamp)
+	require.Equal(t, time.Millisecond*520, got[0].EndTimestamp)
+	require.Equal(t, time.Millisecond*99500, got[1].StartTimestamp)
+	require.Equal(t, time.Millisecond*101520, got[1].EndTimestamp)
+
+	// the original is not modified
+	require.Equal(t, time.Second, dialog[0].StartTimestamp)
+}
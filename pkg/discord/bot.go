@@ -16,13 +16,16 @@ import (
 	"github.com/warmans/tvgif/pkg/searchterms"
 	"github.com/warmans/tvgif/pkg/store"
 	"github.com/warmans/tvgif/pkg/util"
+	"io"
 	"log"
 	"log/slog"
 	"net/http"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,6 +37,7 @@ const (
 	CommandSearch Command = "tvgif"
 	CommandHelp   Command = "tvgif-help"
 	CommandDelete Command = "tvgif-delete"
+	CommandUpload Command = "tvgif-overlay-upload"
 )
 
 type Action string
@@ -51,6 +55,10 @@ const (
 	ActionOpenExtendTrimModal      = Action("oem")
 	ActionOpenMergeModal           = Action("omm")
 	ActionOpenAdvancedOverlayModal = Action("aom")
+	ActionOpenFrameOffsetModal     = Action("ofo")
+	ActionOpenCompositionModal     = Action("ocm")
+	ActionOpenTextBlockModal       = Action("otb")
+	ActionSaveEpisodeOffset        = Action("seo")
 )
 
 const (
@@ -59,8 +67,36 @@ const (
 	ModalActionMergeSubs        = Action("m_ms")
 	ModalSetCaption             = Action("m_sc")
 	ModalSetBoomerOverlayLayout = Action("m_bml")
+	ModalSetFrameOffset         = Action("m_sfo")
+	ModalSetComposition         = Action("m_scm")
+	ModalAddTextBlock           = Action("m_atb")
 )
 
+// sceneCutSearchWindow is how far either side of the start/end of a clip to look for scene cuts.
+const sceneCutSearchWindow = time.Second
+
+// maxTextBlocks is the maximum number of text blocks that can be added in caption mode.
+const maxTextBlocks = 5
+
+// contact sheets show a grid of frames either side of the clip to help with trimming.
+const (
+	contactSheetColumns = 4
+	contactSheetRows    = 3
+	contactSheetPadding = time.Second
+)
+
+var textPositionRegex = regexp.MustCompile(`^(\d+)x(\d+)$`)
+var textColourRegex = regexp.MustCompile(`^(#[0-9a-fA-F]{6}|[a-zA-Z]+)$`)
+
+// maxOverlayUploadSize is the largest overlay image that can be uploaded via the bot.
+const maxOverlayUploadSize = 1024 * 1024 * 5
+
+// overlayDownloadClient is used to fetch uploaded overlays from discord.
+var overlayDownloadClient = &http.Client{Timeout: time.Second * 30}
+
+const slowPlaybackSpeed = 0.5
+const fastPlaybackSpeed = 2.0
+
 var postedByUser = regexp.MustCompile(`.+ posted by \x60([^\x60]+)\x60`)
 var extractState = regexp.MustCompile(`\|\|(\{.*\})\|\|`)
 
@@ -135,9 +171,10 @@ func NewBot(
 	searcher search.Searcher,
 	renderer render.Renderer,
 	botUsername string,
-	srtStore *store.SRTStore,
+	conn *store.Conn,
 	docsRepo *docs.Repo,
 	overlayCache *mediacache.OverlayCache,
+	trustedRoleIDs []string,
 ) (*Bot, error) {
 
 	docsTopics := []*discordgo.ApplicationCommandOptionChoice{
@@ -148,14 +185,16 @@ func NewBot(
 	}
 
 	bot := &Bot{
-		logger:       logger,
-		session:      session,
-		searcher:     searcher,
-		srtStore:     srtStore,
-		botUsername:  botUsername,
-		docs:         docsRepo,
-		renderer:     renderer,
-		overlayCache: overlayCache,
+		logger:         logger,
+		session:        session,
+		searcher:       searcher,
+		conn:           conn,
+		srtStore:       store.NewSRTStore(conn.Db),
+		botUsername:    botUsername,
+		docs:           docsRepo,
+		renderer:       renderer,
+		overlayCache:   overlayCache,
+		trustedRoleIDs: trustedRoleIDs,
 		commands: []*discordgo.ApplicationCommand{
 			{
 				Name:        string(CommandSearch),
@@ -190,12 +229,44 @@ func NewBot(
 				Name: string(CommandDelete),
 				Type: discordgo.MessageApplicationCommand,
 			},
+			{
+				Name:        string(CommandUpload),
+				Description: "Add an image to the overlay library (trusted roles only)",
+				Type:        discordgo.ChatApplicationCommand,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Name:        "file",
+						Description: "GIF, PNG, APNG or WebP image",
+						Type:        discordgo.ApplicationCommandOptionAttachment,
+						Required:    true,
+					},
+					{
+						Name:        "name",
+						Description: "Name of the overlay including extension (defaults to the attachment name)",
+						Type:        discordgo.ApplicationCommandOptionString,
+						Required:    false,
+					},
+					{
+						Name:        "category",
+						Description: "Category e.g. animals",
+						Type:        discordgo.ApplicationCommandOptionString,
+						Required:    false,
+					},
+					{
+						Name:        "tags",
+						Description: "Comma separated tags e.g. cat,happy",
+						Type:        discordgo.ApplicationCommandOptionString,
+						Required:    false,
+					},
+				},
+			},
 		},
 	}
 	bot.commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
 		string(CommandSearch): bot.queryBegin,
 		string(CommandHelp):   bot.helpText,
 		string(CommandDelete): bot.deletePost,
+		string(CommandUpload): bot.uploadOverlay,
 	}
 	bot.buttonHandlers = map[Action]func(s *discordgo.Session, i *discordgo.InteractionCreate, payload string){
 		ActionConfirmPost:              bot.btnPostFromPreview,
@@ -206,6 +277,10 @@ func NewBot(
 		ActionOpenExtendTrimModal:      bot.btnOpenExtendModal,
 		ActionOpenMergeModal:           bot.btnOpenMergeModal,
 		ActionOpenAdvancedOverlayModal: bot.btnOpenAdvancedOverlayModal,
+		ActionOpenFrameOffsetModal:     bot.btnOpenFrameOffsetModal,
+		ActionOpenCompositionModal:     bot.btnOpenCompositionModal,
+		ActionOpenTextBlockModal:       bot.btnOpenTextBlockModal,
+		ActionSaveEpisodeOffset:        bot.btnSaveEpisodeOffset,
 		ActionUpdateState:              bot.btnUpdateState,
 	}
 	bot.modalHandlers = map[Action]func(s *discordgo.Session, i *discordgo.InteractionCreate){
@@ -214,6 +289,9 @@ func NewBot(
 		ModalActionSetExtendValue:   bot.handleModalSetExtendTrimValue,
 		ModalActionMergeSubs:        bot.handleModalMergeSubs,
 		ModalSetBoomerOverlayLayout: bot.handleModalBoomerModeLayout,
+		ModalSetFrameOffset:         bot.handleModalSetFrameOffset,
+		ModalSetComposition:         bot.handleModalSetComposition,
+		ModalAddTextBlock:           bot.handleModalAddTextBlock,
 	}
 
 	return bot, nil
@@ -225,14 +303,19 @@ type Bot struct {
 	searcher        search.Searcher
 	docs            *docs.Repo
 	renderer        render.Renderer
+	conn            *store.Conn
 	srtStore        *store.SRTStore
 	overlayCache    *mediacache.OverlayCache
+	trustedRoleIDs  []string
 	botUsername     string
 	commands        []*discordgo.ApplicationCommand
 	commandHandlers map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate)
 	buttonHandlers  map[Action]func(s *discordgo.Session, i *discordgo.InteractionCreate, payload string)
 	modalHandlers   map[Action]func(s *discordgo.Session, i *discordgo.InteractionCreate)
 	createdCommands []*discordgo.ApplicationCommand
+	// lastInteraction is the unix nano time of the last interaction, used to detect idle periods.
+	lastInteraction atomic.Int64
+	recentSearches  recentIDs
 }
 
 func (b *Bot) Start() error {
@@ -240,6 +323,7 @@ func (b *Bot) Start() error {
 		log.Printf("Logged in as: %v#%v", s.State.User.Username, s.State.User.Discriminator)
 	})
 	b.session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		b.lastInteraction.Store(time.Now().UnixNano())
 		switch i.Type {
 		case discordgo.InteractionApplicationCommand:
 			// exact match
@@ -435,6 +519,9 @@ func (b *Bot) queryBegin(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			b.logger.Error("Failed to fetch autocomplete options", slog.String("err", err.Error()))
 			return
 		}
+		if len(res) > 0 {
+			b.recentSearches.Add(res[0].ID)
+		}
 		var choices []*discordgo.ApplicationCommandOptionChoice
 		for _, v := range res {
 			payload, err := json.Marshal(struct {
@@ -446,6 +533,9 @@ func (b *Bot) queryBegin(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				continue
 			}
 			name := fmt.Sprintf("[%s] %s", v.EpisodeID, v.Content)
+			if v.EpisodeTitle != "" {
+				name = fmt.Sprintf("[%s: %s] %s", v.EpisodeID, v.EpisodeTitle, v.Content)
+			}
 			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
 				Name:  util.TrimToN(name, 100),
 				Value: string(payload),
@@ -801,6 +891,116 @@ func (b *Bot) btnOpenAdvancedOverlayModal(s *discordgo.Session, i *discordgo.Int
 	)
 }
 
+func (b *Bot) btnOpenFrameOffsetModal(s *discordgo.Session, i *discordgo.InteractionCreate, rawMediaID string) {
+	state, err := extractStateFromBody(i.Message.Content)
+	if err != nil {
+		b.respondError(s, i, fmt.Errorf("failed to get current state"))
+		return
+	}
+
+	initialValue := ""
+	if state.Settings.FrameOffset != nil {
+		initialValue = fmt.Sprintf("%0.2f", state.Settings.FrameOffset.Seconds())
+	}
+	b.openGenericValueModal(
+		s,
+		i,
+		rawMediaID,
+		ModalSetFrameOffset,
+		"Frame (Seconds from start e.g. 1.5)",
+		initialValue,
+		discordgo.TextInputShort,
+	)
+}
+
+func (b *Bot) btnOpenCompositionModal(s *discordgo.Session, i *discordgo.InteractionCreate, rawMediaID string) {
+	mediaID, err := media.ParseID(rawMediaID)
+	if err != nil {
+		b.respondError(s, i, fmt.Errorf("invalid mediaID"))
+		return
+	}
+	state, err := extractStateFromBody(i.Message.Content)
+	if err != nil {
+		b.respondError(s, i, fmt.Errorf("failed to get current state"))
+		return
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: encodeAction(ModalSetComposition, mediaID),
+			Title:    "Compose Clips",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "ids",
+							Label:       "Other clips (one ID per line)",
+							Style:       discordgo.TextInputParagraph,
+							Placeholder: "e.g. peepshow-S08E06-1_4",
+							Required:    false,
+							Value:       strings.Join(state.Settings.Composition.IDs, "\n"),
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "layout",
+							Label:       "Layout (sequence, side-by-side, stacked)",
+							Style:       discordgo.TextInputShort,
+							Placeholder: "sequence",
+							Required:    false,
+							Value:       state.Settings.Composition.Layout.String(),
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		b.respondError(s, i, err)
+	}
+}
+
+func (b *Bot) btnOpenTextBlockModal(s *discordgo.Session, i *discordgo.InteractionCreate, rawMediaID string) {
+	mediaID, err := media.ParseID(rawMediaID)
+	if err != nil {
+		b.respondError(s, i, fmt.Errorf("invalid mediaID"))
+		return
+	}
+	textInput := func(id string, label string, style discordgo.TextInputStyle, placeholder string, required bool) discordgo.MessageComponent {
+		return discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.TextInput{
+					CustomID:    id,
+					Label:       label,
+					Style:       style,
+					Placeholder: placeholder,
+					Required:    required,
+					MaxLength:   128,
+				},
+			},
+		}
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: encodeAction(ModalAddTextBlock, mediaID),
+			Title:    "Add Text",
+			Components: []discordgo.MessageComponent{
+				textInput("text", "Text", discordgo.TextInputParagraph, "", true),
+				textInput("position", "Position (top, bottom, center or XxY pixels)", discordgo.TextInputShort, "top", false),
+				textInput("colour", "Colour (e.g. white or #ff0000)", discordgo.TextInputShort, "white", false),
+				textInput("size", "Size", discordgo.TextInputShort, "24", false),
+				textInput("timing", "Timing (seconds e.g. 0.5-2, blank for always)", discordgo.TextInputShort, "", false),
+			},
+		},
+	})
+	if err != nil {
+		b.respondError(s, i, err)
+	}
+}
+
 func (b *Bot) openGenericValueModal(
 	s *discordgo.Session,
 	i *discordgo.InteractionCreate,
@@ -1093,6 +1293,23 @@ func (b *Bot) createButtons(dialog []model2.Dialog, state *PreviewState) ([]disc
 			Disabled: false,
 			CustomID: StateSetSubsEnabled(!state.Settings.SubsEnabled).CustomID(),
 		})
+		captionButtons = append(captionButtons, discordgo.Button{
+			Label: fmt.Sprintf("Add Text (%d/%d)", len(state.Settings.TextBlocks), maxTextBlocks),
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🔤",
+			},
+			Style:    discordgo.SecondaryButton,
+			Disabled: len(state.Settings.TextBlocks) >= maxTextBlocks,
+			CustomID: encodeAction(ActionOpenTextBlockModal, state.ID),
+		})
+		if len(state.Settings.TextBlocks) > 0 {
+			captionButtons = append(captionButtons, discordgo.Button{
+				Label:    "Clear Text",
+				Style:    discordgo.SecondaryButton,
+				Disabled: false,
+				CustomID: ClearTextBlocks().CustomID(),
+			})
+		}
 	}
 
 	boomerButtons := []discordgo.MessageComponent{}
@@ -1157,23 +1374,125 @@ func (b *Bot) createButtons(dialog []model2.Dialog, state *PreviewState) ([]disc
 			Disabled: false,
 			CustomID: encodeAction(ActionNextResult, state.ID),
 		},
+		discordgo.Button{
+			Label: "Options",
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "⚙",
+			},
+			Style:    successBtnIfTrue(state.Settings.ShowOptions),
+			Disabled: false,
+			CustomID: ToggleOptions().CustomID(),
+		},
+	)
+
+	effectButtons := []discordgo.MessageComponent{}
+	if state.Settings.OutputFormat.IsStill() {
+		// playback effects do not apply to stills so the row is used for still options instead.
+		effectButtons = append(effectButtons,
+			discordgo.Button{
+				Label: "PNG",
+				Emoji: &discordgo.ComponentEmoji{
+					Name: "📷",
+				},
+				Style:    successBtnIfTrue(state.Settings.OutputFormat == OutputPng),
+				Disabled: false,
+				CustomID: StateSetOutputFormat(OutputPng).CustomID(),
+			},
+			discordgo.Button{
+				Label: "JPEG",
+				Emoji: &discordgo.ComponentEmoji{
+					Name: "📷",
+				},
+				Style:    successBtnIfTrue(state.Settings.OutputFormat == OutputJpeg),
+				Disabled: false,
+				CustomID: StateSetOutputFormat(OutputJpeg).CustomID(),
+			},
+			discordgo.Button{
+				Label: "Set Frame",
+				Emoji: &discordgo.ComponentEmoji{
+					Name: "⏱",
+				},
+				Style:    successBtnIfTrue(state.Settings.FrameOffset != nil),
+				Disabled: false,
+				CustomID: encodeAction(ActionOpenFrameOffsetModal, state.ID),
+			},
+			discordgo.Button{
+				Label: "Animated",
+				Emoji: &discordgo.ComponentEmoji{
+					Name: "🖼️",
+				},
+				Style:    discordgo.SecondaryButton,
+				Disabled: false,
+				CustomID: StateSetOutputFormat(OutputWebp).CustomID(),
+			},
+		)
+	} else {
+		effectButtons = append(effectButtons, b.playbackButtons(state)...)
+	}
+
+	optionButtons := []discordgo.MessageComponent{
+		discordgo.Button{
+			Label: "Snap to Cut",
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🎬",
+			},
+			Style:    successBtnIfTrue(state.Settings.SnapToScene),
+			Disabled: false,
+			CustomID: ToggleSnapToScene().CustomID(),
+		},
+		discordgo.Button{
+			Label: "Compose",
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🧩",
+			},
+			Style:    successBtnIfTrue(state.Settings.Composition.Enabled()),
+			Disabled: false,
+			CustomID: encodeAction(ActionOpenCompositionModal, state.ID),
+		},
+		discordgo.Button{
+			Label: "Contact Sheet",
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🎞️",
+			},
+			Style:    successBtnIfTrue(state.Settings.ContactSheet),
+			Disabled: false,
+			CustomID: ToggleContactSheet().CustomID(),
+		},
 		discordgo.Button{
 			Label:    "Toggle Preview",
 			Style:    successBtnIfTrue(state.Settings.Mode == CaptionMode),
 			Disabled: false,
 			CustomID: TogglePreview().CustomID(),
 		},
-	)
+	}
+	if state.Settings.Shift != 0 {
+		// only usable by trusted users but there's no way to hide it from everyone else.
+		optionButtons = append(optionButtons, discordgo.Button{
+			Label: "Save Offset",
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "📌",
+			},
+			Style:    discordgo.SecondaryButton,
+			Disabled: false,
+			CustomID: encodeAction(ActionSaveEpisodeOffset, state.ID),
+		})
+	}
 
 	actions := []discordgo.MessageComponent{}
 	if len(navigateButtons) > 0 && state.Settings.Mode == NormalMode {
 		actions = append(actions, discordgo.ActionsRow{Components: navigateButtons})
 	}
-	if len(shiftButtons) > 0 && state.Settings.Mode != CaptionMode {
-		actions = append(actions, discordgo.ActionsRow{Components: shiftButtons})
-	}
-	if len(extendButtons) > 0 && state.Settings.Mode != CaptionMode {
-		actions = append(actions, discordgo.ActionsRow{Components: extendButtons})
+	if state.Settings.ShowOptions {
+		// options replace the shift/extend rows since discord only allows 5 rows per message.
+		actions = append(actions, discordgo.ActionsRow{Components: effectButtons})
+		actions = append(actions, discordgo.ActionsRow{Components: optionButtons})
+	} else {
+		if len(shiftButtons) > 0 && state.Settings.Mode != CaptionMode {
+			actions = append(actions, discordgo.ActionsRow{Components: shiftButtons})
+		}
+		if len(extendButtons) > 0 && state.Settings.Mode != CaptionMode {
+			actions = append(actions, discordgo.ActionsRow{Components: extendButtons})
+		}
 	}
 
 	stickerButtons := b.stickerButtons(state)
@@ -1194,6 +1513,56 @@ func (b *Bot) createButtons(dialog []model2.Dialog, state *PreviewState) ([]disc
 	return actions, nil
 }
 
+func (b *Bot) playbackButtons(state *PreviewState) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.Button{
+			Label: "Slow",
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🐢",
+			},
+			Style:    successBtnIfTrue(state.Settings.Playback.Speed == slowPlaybackSpeed),
+			Disabled: false,
+			CustomID: StateSetSpeed(util.IfElse(state.Settings.Playback.Speed == slowPlaybackSpeed, 0, slowPlaybackSpeed)).CustomID(),
+		},
+		discordgo.Button{
+			Label: "Fast",
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🐇",
+			},
+			Style:    successBtnIfTrue(state.Settings.Playback.Speed == fastPlaybackSpeed),
+			Disabled: false,
+			CustomID: StateSetSpeed(util.IfElse(state.Settings.Playback.Speed == fastPlaybackSpeed, 0, fastPlaybackSpeed)).CustomID(),
+		},
+		discordgo.Button{
+			Label: "Reverse",
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "◀",
+			},
+			Style:    successBtnIfTrue(state.Settings.Playback.Reverse),
+			Disabled: false,
+			CustomID: ToggleReverse().CustomID(),
+		},
+		discordgo.Button{
+			Label: "Boomerang",
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🔁",
+			},
+			Style:    successBtnIfTrue(state.Settings.Playback.Boomerang),
+			Disabled: false,
+			CustomID: ToggleBoomerang().CustomID(),
+		},
+		discordgo.Button{
+			Label: "Still",
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "📷",
+			},
+			Style:    discordgo.SecondaryButton,
+			Disabled: false,
+			CustomID: StateSetOutputFormat(OutputPng).CustomID(),
+		},
+	}
+}
+
 func (b *Bot) stickerButtons(state *PreviewState) []discordgo.MessageComponent {
 	//const panIncrementLarge = 50
 	//const panIncrementSmall = 25
@@ -1279,6 +1648,18 @@ func (b *Bot) handleModalSetCaption(s *discordgo.Session, i *discordgo.Interacti
 	)
 }
 
+func (b *Bot) handleModalAddTextBlock(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	value := func(idx int) string {
+		return strings.TrimSpace(i.Interaction.ModalSubmitData().Components[idx].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value)
+	}
+	block, err := parseTextBlock(value(0), value(1), value(2), value(3), value(4))
+	if err != nil {
+		b.respondError(s, i, err)
+		return
+	}
+	b.updatePreview(s, i, StateAddText(block))
+}
+
 func (b *Bot) handleModalSetSubs(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	b.updatePreview(
 		s,
@@ -1361,6 +1742,88 @@ func (b *Bot) handleModalBoomerModeLayout(s *discordgo.Session, i *discordgo.Int
 	)
 }
 
+func (b *Bot) handleModalSetFrameOffset(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	strVal := i.Interaction.ModalSubmitData().Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+	floatVal, err := strconv.ParseFloat(strVal, 64)
+	if err != nil {
+		b.respondError(s, i, fmt.Errorf("invalid frame offset %s: %w", strVal, err))
+		return
+	}
+	if floatVal < 0 || floatVal*float64(time.Second) > float64(limits.MaxGifDuration) {
+		b.respondError(s, i, fmt.Errorf("invalid frame offset %s: must be within the gif duration", strVal))
+		return
+	}
+	b.updatePreview(s, i, StateSetStillFrameOffset(time.Duration(floatVal*float64(time.Second))))
+}
+
+func (b *Bot) handleModalSetComposition(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	sta, err := extractStateFromBody(i.Message.Content)
+	if err != nil {
+		b.respondError(s, i, fmt.Errorf("failed to get current state"))
+		return
+	}
+
+	rawIDs := i.Interaction.ModalSubmitData().Components[0].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+	rawLayout := i.Interaction.ModalSubmitData().Components[1].(*discordgo.ActionsRow).Components[0].(*discordgo.TextInput).Value
+
+	layout, err := ParseCompositionLayout(rawLayout)
+	if err != nil {
+		b.respondError(s, i, err)
+		return
+	}
+
+	totalDuration, err := b.srtStore.GetDuration(
+		sta.ID.Publication,
+		sta.ID.Series,
+		sta.ID.Episode,
+		sta.ID.StartPosition,
+		sta.ID.EndPosition,
+	)
+	if err != nil {
+		b.respondError(s, i, fmt.Errorf("failed to get duration: %w", err))
+		return
+	}
+
+	ids := []string{}
+	for _, line := range util.TrimStrings(strings.Split(rawIDs, "\n")) {
+		if line == "" {
+			continue
+		}
+		mediaID, err := media.ParseID(line)
+		if err != nil {
+			b.respondError(s, i, fmt.Errorf("invalid clip ID %s: %w", line, err))
+			return
+		}
+		duration, err := b.srtStore.GetDuration(
+			mediaID.Publication,
+			mediaID.Series,
+			mediaID.Episode,
+			mediaID.StartPosition,
+			mediaID.EndPosition,
+		)
+		if err != nil {
+			b.respondError(s, i, fmt.Errorf("failed to get duration of %s: %w", line, err))
+			return
+		}
+		if duration > limits.MaxGifDuration {
+			b.respondError(s, i, fmt.Errorf("clip %s exceeds max gif duration (max %s, got %s)", line, limits.MaxGifDuration.String(), duration.String()))
+			return
+		}
+		totalDuration += duration
+		ids = append(ids, mediaID.String())
+	}
+	if len(ids)+1 > limits.MaxComposedClips {
+		b.respondError(s, i, fmt.Errorf("cannot compose more than %d clips", limits.MaxComposedClips))
+		return
+	}
+	if layout == CompositionSequence && totalDuration > limits.MaxGifDuration {
+		b.respondError(s, i, fmt.Errorf("clips exceed max gif duration (max %s, got %s)", limits.MaxGifDuration.String(), totalDuration.String()))
+		return
+	}
+
+	b.updatePreview(s, i, StateSetCompositionOpts(CompositionOpts{IDs: ids, Layout: layout}))
+}
+
 func (b *Bot) btnPostFromPreview(s *discordgo.Session, i *discordgo.InteractionCreate, payload string) {
 
 	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -1387,6 +1850,7 @@ func (b *Bot) btnPostFromPreview(s *discordgo.Session, i *discordgo.InteractionC
 		return
 	}
 	var files []*discordgo.File
+	var renderProfile *render.EncodingProfile
 	if len(i.Message.Attachments) > 0 && state.Settings.Mode != BoomerMode {
 		attachment := i.Message.Attachments[0]
 		image, err := http.Get(attachment.URL)
@@ -1404,12 +1868,13 @@ func (b *Bot) btnPostFromPreview(s *discordgo.Session, i *discordgo.InteractionC
 	} else {
 		// if there was no attachment (e.g. preview disabled, render the file), or the gif needs to be re-rendered
 		// without boomer layout grid
-		file, err := b.renderFile(state, dialogWithContext.Dialog, false)
+		result, err := b.renderFile(state, dialogWithContext.Dialog, false)
 		if err != nil {
 			b.respondError(s, i, fmt.Errorf("failed to render file: %w", err))
 			return
 		}
-		files = append(files, file)
+		files = append(files, result.File)
+		renderProfile = result.Profile
 	}
 
 	if _, err := s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
@@ -1419,6 +1884,7 @@ func (b *Bot) btnPostFromPreview(s *discordgo.Session, i *discordgo.InteractionC
 			dialogWithContext,
 			state.Settings.OverrideSubs != nil,
 			false,
+			renderProfile,
 		),
 		Files:       files,
 		Attachments: []*discordgo.MessageAttachment{},
@@ -1426,6 +1892,9 @@ func (b *Bot) btnPostFromPreview(s *discordgo.Session, i *discordgo.InteractionC
 		b.respondError(s, i, err)
 		return
 	}
+	if err := b.srtStore.RecordPost(state.ID.String()); err != nil {
+		b.logger.Error("failed to record post", slog.String("err", err.Error()))
+	}
 }
 
 func (b *Bot) buildInteractionResponseForPreview(
@@ -1449,15 +1918,29 @@ func (b *Bot) buildInteractionResponseForPreview(
 	}
 
 	var files []*discordgo.File
+	var renderProfile *render.EncodingProfile
 
 	var bodyText string
 	if !opts.placeholder && !opts.disableImagePreview {
-		gif, err := b.renderFile(state, dialogWithContext.Dialog, true)
+		result, err := b.renderFile(state, dialogWithContext.Dialog, true)
 		if err != nil {
 			return nil, err
 		}
-		files = []*discordgo.File{gif}
+		if err := b.srtStore.RecordRender(state.ID.String()); err != nil {
+			b.logger.Error("failed to record render", slog.String("err", err.Error()))
+		}
+		files = []*discordgo.File{result.File}
+		renderProfile = result.Profile
 		bodyText = ""
+
+		// the contact sheet must come after the preview since posting re-uses the first attachment.
+		if state.Settings.ContactSheet {
+			sheet, err := b.renderContactSheet(state, dialogWithContext.Dialog)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, sheet.File)
+		}
 	} else {
 		if !opts.disableImagePreview {
 			bodyText = ":timer: Rendering..."
@@ -1483,6 +1966,7 @@ func (b *Bot) buildInteractionResponseForPreview(
 					dialogWithContext,
 					state.Settings.OverrideSubs != nil,
 					opts.isPreview,
+					renderProfile,
 				),
 				mustEncodeState(state),
 				info,
@@ -1493,7 +1977,14 @@ func (b *Bot) buildInteractionResponseForPreview(
 	}, nil
 }
 
-func (b *Bot) mediaDescription(state *PreviewState, username string, dialogWithContext *DialogWithContext, edited bool, includeDialogText bool) string {
+func (b *Bot) mediaDescription(
+	state *PreviewState,
+	username string,
+	dialogWithContext *DialogWithContext,
+	edited bool,
+	includeDialogText bool,
+	renderProfile *render.EncodingProfile,
+) string {
 	editLabel := ""
 	if edited {
 		editLabel = " (edited)"
@@ -1518,14 +2009,38 @@ func (b *Bot) mediaDescription(state *PreviewState, username string, dialogWithC
 	if state.Settings.Mode != NormalMode {
 		modeLabel = fmt.Sprintf("(%s)", state.Settings.Mode)
 	}
+	if state.Settings.SnapToScene {
+		modeLabel += "(snapped)"
+	}
+	if state.Settings.Composition.Enabled() {
+		modeLabel += fmt.Sprintf("(%s with %s)", state.Settings.Composition.Layout.String(), strings.Join(state.Settings.Composition.IDs, ", "))
+	}
+	if state.Settings.OutputFormat.IsStill() {
+		modeLabel += "(still)"
+	} else {
+		modeLabel += state.Settings.Playback.String()
+	}
+
+	reducedLabel := ""
+	if renderProfile != nil {
+		reducedLabel = fmt.Sprintf("(reduced: %s)", renderProfile.String())
+	}
 
 	dialogText := ""
 	if includeDialogText {
 		dialogText = dialogWithContext.String()
 	}
 
+	episodeLabel := ""
+	info, err := b.srtStore.GetEpisodeInfo(state.ID.Publication, state.ID.Series, state.ID.Episode)
+	if err != nil {
+		b.logger.Error("failed to get episode info", slog.String("err", err.Error()))
+	} else if label := info.String(); label != "" {
+		episodeLabel = fmt.Sprintf("\n*%s*", label)
+	}
+
 	return fmt.Sprintf(
-		"`%s@%s-%s%s%s%s%s` posted by `%s`\n\n%s",
+		"`%s@%s-%s%s%s%s%s%s` posted by `%s`%s\n\n%s",
 		state.ID.DialogID(),
 		dialogWithContext.Dialog[0].StartTimestamp,
 		dialogWithContext.Dialog[len(dialogWithContext.Dialog)-1].EndTimestamp,
@@ -1533,7 +2048,9 @@ func (b *Bot) mediaDescription(state *PreviewState, username string, dialogWithC
 		extendLabel,
 		editLabel,
 		modeLabel,
+		reducedLabel,
 		username,
+		episodeLabel,
 		dialogText,
 	)
 }
@@ -1553,9 +2070,8 @@ func (b *Bot) respondError(s *discordgo.Session, i *discordgo.InteractionCreate,
 	}
 }
 
-func (b *Bot) renderFile(state *PreviewState, dialog []model2.Dialog, preview bool) (*discordgo.File, error) {
-
-	disableCaching := state.Settings.ExtendOrTrim != 0 || state.Settings.Shift != 0 || state.Settings.OverrideSubs != nil || (state.Settings.Mode != NormalMode)
+// clipRange gets the start and end of the clip after the user's adjustments have been applied.
+func (b *Bot) clipRange(state *PreviewState, dialog []model2.Dialog) (time.Duration, time.Duration) {
 	startTimestamp := dialog[0].StartTimestamp
 	endTimestamp := dialog[len(dialog)-1].EndTimestamp
 
@@ -1569,9 +2085,37 @@ func (b *Bot) renderFile(state *PreviewState, dialog []model2.Dialog, preview bo
 			endTimestamp = startTimestamp + time.Second
 		}
 	}
+	if state.Settings.SnapToScene {
+		startTimestamp, endTimestamp = b.snapToSceneCuts(dialog[0].VideoFileName, startTimestamp, endTimestamp)
+	}
 	if endTimestamp-startTimestamp > limits.MaxGifDuration {
 		endTimestamp = startTimestamp + limits.MaxGifDuration
 	}
+	return startTimestamp, endTimestamp
+}
+
+// renderContactSheet renders a grid of frames covering the clip for use when deciding where to trim.
+func (b *Bot) renderContactSheet(state *PreviewState, dialog []model2.Dialog) (*render.Result, error) {
+	startTimestamp, endTimestamp := b.clipRange(state, dialog)
+
+	result, err := b.renderer.RenderFile(
+		dialog[0].VideoFileName,
+		state.ID,
+		dialog,
+		render.WithStartTimestamp(startTimestamp),
+		render.WithEndTimestamp(endTimestamp),
+		render.WithContactSheet(contactSheetColumns, contactSheetRows, contactSheetPadding),
+	)
+	if err != nil {
+		b.logger.Error("failed to render contact sheet", slog.String("err", err.Error()))
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *Bot) renderFile(state *PreviewState, dialog []model2.Dialog, preview bool) (*render.Result, error) {
+
+	startTimestamp, endTimestamp := b.clipRange(state, dialog)
 
 	logger := b.logger.With(
 		slog.String("cache_key", state.ID.DialogID()),
@@ -1585,10 +2129,31 @@ func (b *Bot) renderFile(state *PreviewState, dialog []model2.Dialog, preview bo
 	logger.Debug("Rendering file...")
 
 	options := []render.Option{
-		render.WithCaching(disableCaching),
 		render.WithCustomText(state.Settings.OverrideSubs),
 		render.WithStartTimestamp(startTimestamp),
 		render.WithEndTimestamp(endTimestamp),
+		render.WithSizeBudget(limits.MaxUploadSize),
+	}
+	if !state.Settings.Playback.IsDefault() {
+		options = append(options,
+			render.WithSpeed(state.Settings.Playback.Speed),
+			render.WithReverse(state.Settings.Playback.Reverse),
+			render.WithBoomerang(state.Settings.Playback.Boomerang),
+		)
+	}
+	if state.Settings.Composition.Enabled() {
+		clips, err := b.compositionClips(state.Settings.Composition)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, render.WithComposition(
+			map[CompositionLayout]render.CompositionLayout{
+				CompositionSequence:   render.CompositionSequence,
+				CompositionSideBySide: render.CompositionHStack,
+				CompositionStacked:    render.CompositionVStack,
+			}[state.Settings.Composition.Layout],
+			clips,
+		))
 	}
 	if state.Settings.Mode == BoomerMode {
 		options = append(options,
@@ -1601,6 +2166,7 @@ func (b *Bot) renderFile(state *PreviewState, dialog []model2.Dialog, preview bo
 			render.WithCaptionMode(true),
 			render.WithCaption(state.Settings.Caption),
 			render.WithDisableSubs(state.Settings.SubsEnabled),
+			render.WithTextBlocks(renderTextBlocks(state.Settings.TextBlocks)),
 		)
 	}
 	if state.Settings.Mode == StickerMode {
@@ -1622,11 +2188,15 @@ func (b *Bot) renderFile(state *PreviewState, dialog []model2.Dialog, preview bo
 		options = append(options, render.WithOutputFileType(render.OutputGif))
 	case OutputWebm:
 		options = append(options, render.WithOutputFileType(render.OutputWebm))
+	case OutputPng:
+		options = append(options, render.WithOutputFileType(render.OutputPng), render.WithFrameOffset(state.Settings.FrameOffset))
+	case OutputJpeg:
+		options = append(options, render.WithOutputFileType(render.OutputJpeg), render.WithFrameOffset(state.Settings.FrameOffset))
 	default:
 		options = append(options, render.WithOutputFileType(render.OutputWebp))
 	}
 
-	file, err := b.renderer.RenderFile(
+	result, err := b.renderer.RenderFile(
 		dialog[0].VideoFileName,
 		state.ID,
 		dialog,
@@ -1636,7 +2206,264 @@ func (b *Bot) renderFile(state *PreviewState, dialog []model2.Dialog, preview bo
 		b.logger.Error("failed to render file", slog.String("err", err.Error()))
 		return nil, err
 	}
-	return file, nil
+	return result, nil
+}
+
+func parseTextBlock(text string, position string, colour string, size string, timing string) (TextBlock, error) {
+	block := TextBlock{Text: text, Position: strings.ToLower(position), Colour: colour}
+	if block.Text == "" {
+		return block, fmt.Errorf("text cannot be empty")
+	}
+	switch block.Position {
+	case "", "top", "bottom", "center":
+	case "middle":
+		block.Position = "center"
+	default:
+		if !textPositionRegex.MatchString(block.Position) {
+			return block, fmt.Errorf("invalid position %s: expected top, bottom, center or XxY", position)
+		}
+	}
+	if block.Colour != "" && !textColourRegex.MatchString(block.Colour) {
+		return block, fmt.Errorf("invalid colour %s: expected a name or hex code e.g. #ff0000", colour)
+	}
+	if size != "" {
+		intVal, err := strconv.Atoi(size)
+		if err != nil || intVal < 8 || intVal > 72 {
+			return block, fmt.Errorf("invalid size %s: expected a number between 8 and 72", size)
+		}
+		block.Size = intVal
+	}
+	if timing != "" {
+		startEnd := strings.SplitN(timing, "-", 2)
+		if len(startEnd) != 2 {
+			return block, fmt.Errorf("invalid timing %s: expected start-end e.g. 0.5-2", timing)
+		}
+		start, err := strconv.ParseFloat(startEnd[0], 64)
+		if err != nil {
+			return block, fmt.Errorf("invalid timing start %s: %w", startEnd[0], err)
+		}
+		end, err := strconv.ParseFloat(startEnd[1], 64)
+		if err != nil {
+			return block, fmt.Errorf("invalid timing end %s: %w", startEnd[1], err)
+		}
+		if start < 0 || end <= start {
+			return block, fmt.Errorf("invalid timing %s: end must be after start", timing)
+		}
+		block.Start, block.End = start, end
+	}
+	return block, nil
+}
+
+func renderTextBlocks(blocks []TextBlock) []render.TextBlock {
+	out := []render.TextBlock{}
+	for _, block := range blocks {
+		rendered := render.TextBlock{
+			Text:     block.Text,
+			Position: render.TextPosition(block.Position),
+			Colour:   block.Colour,
+			Size:     block.Size,
+			Start:    time.Duration(block.Start * float64(time.Second)),
+			End:      time.Duration(block.End * float64(time.Second)),
+		}
+		if match := textPositionRegex.FindStringSubmatch(block.Position); match != nil {
+			rendered.Position = render.TextCustom
+			rendered.X, _ = strconv.Atoi(match[1])
+			rendered.Y, _ = strconv.Atoi(match[2])
+		}
+		out = append(out, rendered)
+	}
+	return out
+}
+
+// compositionClips fetches the dialog for each of the additional clips in a composition.
+func (b *Bot) compositionClips(opts CompositionOpts) ([]render.Clip, error) {
+	clips := []render.Clip{}
+	for _, rawID := range opts.IDs {
+		mediaID, err := media.ParseID(rawID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid composition clip ID %s: %w", rawID, err)
+		}
+		dialog, err := b.srtStore.GetDialogRange(
+			mediaID.Publication,
+			mediaID.Series,
+			mediaID.Episode,
+			mediaID.StartPosition,
+			mediaID.EndPosition,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch dialog for composition clip %s: %w", rawID, err)
+		}
+		if len(dialog) == 0 {
+			return nil, fmt.Errorf("no dialog found for composition clip %s", rawID)
+		}
+		clips = append(clips, render.Clip{
+			VideoFileName:  dialog[0].VideoFileName,
+			Publication:    mediaID.Publication,
+			Dialog:         dialog,
+			StartTimestamp: dialog[0].StartTimestamp,
+			EndTimestamp:   dialog[len(dialog)-1].EndTimestamp,
+		})
+	}
+	return clips, nil
+}
+
+// snapToSceneCuts moves the start/end timestamps to the nearest shot change (if there is one close by)
+// to avoid stray frames from the previous/next shot.
+func (b *Bot) snapToSceneCuts(videoFileName string, startTimestamp time.Duration, endTimestamp time.Duration) (time.Duration, time.Duration) {
+	detector, ok := b.renderer.(render.SceneCutDetector)
+	if !ok {
+		b.logger.Warn("Renderer does not support scene detection")
+		return startTimestamp, endTimestamp
+	}
+	logger := b.logger.With(slog.String("source", videoFileName))
+
+	newStart := startTimestamp
+	cuts, err := detector.SceneCuts(videoFileName, startTimestamp-sceneCutSearchWindow, startTimestamp+sceneCutSearchWindow)
+	if err != nil {
+		logger.Error("failed to find start scene cut", slog.String("err", err.Error()))
+	} else if cut, found := render.NearestCut(cuts, startTimestamp, sceneCutSearchWindow); found {
+		newStart = cut
+	}
+
+	newEnd := endTimestamp
+	cuts, err = detector.SceneCuts(videoFileName, endTimestamp-sceneCutSearchWindow, endTimestamp+sceneCutSearchWindow)
+	if err != nil {
+		logger.Error("failed to find end scene cut", slog.String("err", err.Error()))
+	} else if cut, found := render.NearestCut(cuts, endTimestamp, sceneCutSearchWindow); found {
+		newEnd = cut
+	}
+
+	if newEnd <= newStart {
+		return startTimestamp, endTimestamp
+	}
+	logger.Debug("Snapped to scene cuts", slog.Duration("start", newStart), slog.Duration("end", newEnd))
+	return newStart, newEnd
+}
+
+func (b *Bot) uploadOverlay(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !b.isTrusted(i) {
+		b.respondError(s, i, fmt.Errorf("you are not allowed to upload overlays"))
+		return
+	}
+
+	data := i.ApplicationCommandData()
+
+	var attachment *discordgo.MessageAttachment
+	name, category, tags := "", "", ""
+	for _, opt := range data.Options {
+		switch opt.Name {
+		case "file":
+			attachment = data.Resolved.Attachments[opt.Value.(string)]
+		case "name":
+			name = opt.StringValue()
+		case "category":
+			category = opt.StringValue()
+		case "tags":
+			tags = opt.StringValue()
+		}
+	}
+	if attachment == nil {
+		b.respondError(s, i, fmt.Errorf("no attachment was provided"))
+		return
+	}
+	if attachment.Size > maxOverlayUploadSize {
+		b.respondError(s, i, fmt.Errorf("attachment is too large (max %d bytes)", maxOverlayUploadSize))
+		return
+	}
+	if name == "" {
+		name = attachment.Filename
+	}
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	}); err != nil {
+		b.respondError(s, i, fmt.Errorf("failed to begin interaction: %w", err))
+		return
+	}
+
+	respond := func(content string) {
+		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: util.ToPtr(content)}); err != nil {
+			b.logger.Error("failed to respond", slog.String("err", err.Error()))
+		}
+	}
+
+	resp, err := overlayDownloadClient.Get(attachment.URL)
+	if err != nil {
+		respond(fmt.Sprintf("Failed to download attachment: %s", err.Error()))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respond(fmt.Sprintf("Failed to download attachment: unexpected status %s", resp.Status))
+		return
+	}
+
+	imageData, err := io.ReadAll(io.LimitReader(resp.Body, maxOverlayUploadSize))
+	if err != nil {
+		respond(fmt.Sprintf("Failed to download attachment: %s", err.Error()))
+		return
+	}
+
+	overlay, err := b.overlayCache.Add(name, imageData, mediacache.OverlayManifestEntry{
+		Category: strings.TrimSpace(category),
+		Tags:     util.SplitNonEmpty(tags, ","),
+	})
+	if err != nil {
+		respond(fmt.Sprintf("Failed to add overlay: %s", err.Error()))
+		return
+	}
+
+	b.logger.Info("Overlay uploaded", slog.String("name", overlay.Name), slog.String("user", uniqueUser(i.Member, i.User)))
+	respond(fmt.Sprintf("Added overlay `%s` (%dx%d)", overlay.Name, overlay.Width, overlay.Height))
+}
+
+// btnSaveEpisodeOffset makes the current shift permanent for the whole episode e.g. if all the subtitles are late.
+// The dialog in the DB is shifted immediately so the preview can drop its shift. The episode is also queued to be
+// re-imported from its SRT with the offset applied, which updates the metadata and search index.
+func (b *Bot) btnSaveEpisodeOffset(s *discordgo.Session, i *discordgo.InteractionCreate, payload string) {
+	if !b.isTrusted(i) {
+		b.respondError(s, i, fmt.Errorf("you are not allowed to change episode offsets"))
+		return
+	}
+	sta, err := extractStateFromBody(i.Message.Content)
+	if err != nil {
+		b.respondError(s, i, fmt.Errorf("failed to get current state"))
+		return
+	}
+	if sta.Settings.Shift == 0 {
+		b.respondError(s, i, fmt.Errorf("there is no shift to save"))
+		return
+	}
+	offset, err := b.conn.SaveEpisodeShift(sta.ID.Publication, sta.ID.Series, sta.ID.Episode, sta.Settings.Shift)
+	if err != nil {
+		b.respondError(s, i, err)
+		return
+	}
+	b.logger.Info(
+		"Episode offset saved",
+		slog.String("episode_id", sta.ID.EpisodeID()),
+		slog.Duration("offset", offset.Offset),
+		slog.String("user", uniqueUser(i.Member, i.User)),
+	)
+
+	// the shift is now included in the dialog timestamps so must be removed from the preview.
+	b.updatePreview(s, i, StateSetShift(0))
+}
+
+// isTrusted checks if the user has one of the trusted roles.
+func (b *Bot) isTrusted(i *discordgo.InteractionCreate) bool {
+	if i.Member == nil {
+		return false
+	}
+	for _, role := range i.Member.Roles {
+		if slices.Contains(b.trustedRoleIDs, role) {
+			return true
+		}
+	}
+	return false
 }
 
 func (b *Bot) helpText(s *discordgo.Session, i *discordgo.InteractionCreate) {
@@ -1661,7 +2488,11 @@ func (b *Bot) helpText(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			if v.Group != "" {
 				groupStr = fmt.Sprintf(" (~%s)", v.Group)
 			}
-			if _, err := fmt.Fprintf(sb, "* `%s%s` - `S[%s]`\n", v.Name, groupStr, strings.Join(v.Series, ", ")); err != nil {
+			displayNameStr := ""
+			if v.DisplayName != "" {
+				displayNameStr = fmt.Sprintf(" %s", v.DisplayName)
+			}
+			if _, err := fmt.Fprintf(sb, "* `%s%s`%s - `S[%s]`\n", v.Name, groupStr, displayNameStr, strings.Join(v.Series, ", ")); err != nil {
 				b.respondError(s, i, err)
 				return
 			}
@@ -1804,9 +2635,22 @@ func (b *Bot) getBoomerModeInitialLayout() string {
 #
 # You may also duplicate lines.
 # Cell numbers are decimals and start at 0 (so you can do e.g. 3.5).
-# Currently the only optional arg is "f" to flip the image horizontally.
+# Optional args are:
+#   f          flip the image horizontally.
+#   t=0.5-2.0  only show the overlay between 0.5 and 2 seconds.
+#   r=45       rotate the image 45 degrees clockwise.
+#   o=0.5      set the image opacity to 50%.
+#
+# Instead of a cell you can use @face0 to place the overlay on the first
+# face (from the left) in the clip, @face1 for the second face etc. e.g.
+#    @face0 foo.gif 0.5
+#
+# To move an overlay give a start and end cell. It will move over
+# the whole clip or the time given by the t arg e.g.
+#    0x0->6x4 foo.gif 1 t=0.5-2.0
 #
 # View available overlays here: http://tvgif.scrimpton.com:8080/overlays/index.html
+# Search by name, category or tag: http://tvgif.scrimpton.com:8080/overlays/search.json?q=cat
 #
 # Here are 10 random overlays:
 `,
@@ -17,12 +17,7 @@ type ID struct {
 }
 
 func (i *ID) String() string {
-	return fmt.Sprintf(
-		"%s-%s-%s",
-		i.Publication,
-		util.FormatSeriesAndEpisode(int(i.Series), int(i.Episode)),
-		i.FormatPositionRange(),
-	)
+	return fmt.Sprintf("%s-%s", i.EpisodeID(), i.FormatPositionRange())
 }
 
 func (i *ID) DialogID() string {
@@ -34,7 +29,7 @@ func (i *ID) DialogIDWithRange(customRange string) string {
 }
 
 func (i *ID) EpisodeID() string {
-	return fmt.Sprintf("%s-%s", i.Publication, util.FormatSeriesAndEpisode(int(i.Series), int(i.Episode)))
+	return util.FormatEpisodeID(i.Publication, i.Series, i.Episode)
 }
 
 func (i *ID) PositionRange() int64 {
@@ -70,28 +65,25 @@ func (i *ID) WithEndPosition(end int64) *ID {
 	return &cp
 }
 
-// ParseID e.g. peepshow-S08E06-1[_4]
+// ParseID e.g. peepshow-S08E06-1[_4] or the-italian-job-1[_4] (films have no series or episode).
 func ParseID(payloadStr string) (*ID, error) {
 
-	parts := strings.SplitN(payloadStr, "-", 4)
-	if len(parts) < 3 {
+	episodeID, positionRange, err := util.SplitDialogID(payloadStr)
+	if err != nil {
 		return nil, fmt.Errorf("unrecognized payload format: %s", payloadStr)
 	}
-	payload := &ID{
-		Publication: parts[0],
-	}
-	var err error
-	payload.Series, payload.Episode, err = util.ExtractSeriesAndEpisode(parts[1])
+	payload := &ID{}
+	payload.Publication, payload.Series, payload.Episode, err = util.ParseEpisodeID(episodeID)
 	if err != nil {
 		return nil, fmt.Errorf("unrecognozied episode format: %w", err)
 	}
 
-	if parts[2] != "" {
+	if positionRange != "" {
 		var startAndEnd []string
-		if strings.Contains(parts[2], "_") {
-			startAndEnd = strings.SplitN(parts[2], "_", 2)
+		if strings.Contains(positionRange, "_") {
+			startAndEnd = strings.SplitN(positionRange, "_", 2)
 		} else {
-			startAndEnd = []string{parts[2], parts[2]}
+			startAndEnd = []string{positionRange, positionRange}
 		}
 		startPosition, err := strconv.Atoi(startAndEnd[0])
 		if err != nil {
@@ -0,0 +1,38 @@
+package media
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    *ID
+		wantErr bool
+	}{
+		{raw: "peepshow-S08E06-1", want: &ID{Publication: "peepshow", Series: 8, Episode: 6, StartPosition: 1, EndPosition: 1}},
+		{raw: "peepshow-S08E06-1_4", want: &ID{Publication: "peepshow", Series: 8, Episode: 6, StartPosition: 1, EndPosition: 4}},
+		{raw: "peepshow-S08E06-", want: &ID{Publication: "peepshow", Series: 8, Episode: 6}},
+		{raw: "the-thick-of-it-S00E01-2", want: &ID{Publication: "the-thick-of-it", Series: 0, Episode: 1, StartPosition: 2, EndPosition: 2}},
+		{raw: "the-italian-job-5_6", want: &ID{Publication: "the-italian-job", StartPosition: 5, EndPosition: 6}},
+		{raw: "peepshow-S08E06", wantErr: true},
+		{raw: "peepshow", wantErr: true},
+		{raw: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseID(tt.raw)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+			if !strings.HasSuffix(tt.raw, "-") {
+				require.Equal(t, tt.raw, got.String())
+			}
+		})
+	}
+}
@@ -23,6 +23,16 @@ const StateUpdateMode = StateUpdateType("set_mode")
 const StateUpdateOutputFormat = StateUpdateType("set_output_format")
 const StateTogglePreview = StateUpdateType("toggle_preview")
 const StateSetBoomerModeLayout = StateUpdateType("set_boomer_mode_layout")
+const StateToggleOptions = StateUpdateType("toggle_options")
+const StateToggleSnapToScene = StateUpdateType("toggle_snap_to_scene")
+const StateSetPlaybackSpeed = StateUpdateType("set_playback_speed")
+const StateTogglePlaybackReverse = StateUpdateType("toggle_playback_reverse")
+const StateTogglePlaybackBoomerang = StateUpdateType("toggle_playback_boomerang")
+const StateSetFrameOffset = StateUpdateType("set_frame_offset")
+const StateSetComposition = StateUpdateType("set_composition")
+const StateAddTextBlock = StateUpdateType("add_text_block")
+const StateClearTextBlocks = StateUpdateType("clear_text_blocks")
+const StateToggleContactSheet = StateUpdateType("toggle_contact_sheet")
 
 type Mode string
 
@@ -41,8 +51,14 @@ const (
 	OutputGif     = OutputFileType("gif")
 	OutputWebm    = OutputFileType("webm")
 	OutputWebp    = OutputFileType("webp")
+	OutputPng     = OutputFileType("png")
+	OutputJpeg    = OutputFileType("jpeg")
 )
 
+func (o OutputFileType) IsStill() bool {
+	return o == OutputPng || o == OutputJpeg
+}
+
 func defaultSetting() Settings {
 	return Settings{
 		OutputFormat: OutputWebp,
@@ -60,20 +76,36 @@ type Settings struct {
 	OutputFormat        OutputFileType `json:"o,omitempty"`
 	DisablePreviewImage bool           `json:"n,omitempty"`
 	BoomerModeOpts      BoomerModeOpts `json:"bc,omitempty"`
+	ShowOptions         bool           `json:"op,omitempty"`
+	SnapToScene         bool           `json:"sc,omitempty"`
+	Playback            PlaybackOpts   `json:"pb,omitempty"`
+	// FrameOffset is the position of the frame used for still images. If nil the middle frame is used.
+	FrameOffset *time.Duration  `json:"fo,omitempty"`
+	Composition CompositionOpts `json:"cm,omitempty"`
+	TextBlocks  []TextBlock     `json:"tb,omitempty"`
+	// ContactSheet adds an image of frames across the clip to the preview to help with trimming.
+	ContactSheet bool `json:"cs,omitempty"`
 }
 
 // rawSettings is just Settings with simple types used for encoding/decoding
 type rawSettings struct {
-	ExtendOrTrim   string         `json:"x,omitempty"`
-	Shift          string         `json:"s,omitempty"`
-	Mode           Mode           `json:"m,omitempty"`
-	Sticker        *stickerOpts   `json:"t,omitempty"`
-	Caption        string         `json:"c,omitempty"`
-	OverrideSubs   []string       `json:"u,omitempty"`
-	SubsEnabled    bool           `json:"d,omitempty"`
-	OutputFormat   OutputFileType `json:"o,omitempty"`
-	DisablePreview bool           `json:"n,omitempty"`
-	BoomerModeOpts BoomerModeOpts `json:"bc,omitempty"`
+	ExtendOrTrim   string          `json:"x,omitempty"`
+	Shift          string          `json:"s,omitempty"`
+	Mode           Mode            `json:"m,omitempty"`
+	Sticker        *stickerOpts    `json:"t,omitempty"`
+	Caption        string          `json:"c,omitempty"`
+	OverrideSubs   []string        `json:"u,omitempty"`
+	SubsEnabled    bool            `json:"d,omitempty"`
+	OutputFormat   OutputFileType  `json:"o,omitempty"`
+	DisablePreview bool            `json:"n,omitempty"`
+	BoomerModeOpts BoomerModeOpts  `json:"bc,omitempty"`
+	ShowOptions    bool            `json:"op,omitempty"`
+	SnapToScene    bool            `json:"sc,omitempty"`
+	Playback       PlaybackOpts    `json:"pb,omitempty"`
+	FrameOffset    string          `json:"fo,omitempty"`
+	Composition    CompositionOpts `json:"cm,omitempty"`
+	TextBlocks     []TextBlock     `json:"tb,omitempty"`
+	ContactSheet   bool            `json:"cs,omitempty"`
 }
 
 func (c *Settings) UnmarshalJSON(bytes []byte) error {
@@ -91,6 +123,13 @@ func (c *Settings) UnmarshalJSON(bytes []byte) error {
 	if err != nil {
 		return err
 	}
+	if raw.FrameOffset != "" {
+		frameOffset, err := time.ParseDuration(raw.FrameOffset)
+		if err != nil {
+			return err
+		}
+		c.FrameOffset = &frameOffset
+	}
 
 	// todo: this is annoying, these all have to be copied manually
 	// also see MarshalJSON for similar copying
@@ -102,11 +141,21 @@ func (c *Settings) UnmarshalJSON(bytes []byte) error {
 	c.OutputFormat = raw.OutputFormat
 	c.DisablePreviewImage = raw.DisablePreview
 	c.BoomerModeOpts = raw.BoomerModeOpts
+	c.ShowOptions = raw.ShowOptions
+	c.SnapToScene = raw.SnapToScene
+	c.Playback = raw.Playback
+	c.Composition = raw.Composition
+	c.TextBlocks = raw.TextBlocks
+	c.ContactSheet = raw.ContactSheet
 
 	return nil
 }
 
 func (c *Settings) MarshalJSON() ([]byte, error) {
+	frameOffset := ""
+	if c.FrameOffset != nil {
+		frameOffset = c.FrameOffset.String()
+	}
 	return json.Marshal(rawSettings{
 		ExtendOrTrim:   c.ExtendOrTrim.String(),
 		Shift:          c.Shift.String(),
@@ -118,6 +167,13 @@ func (c *Settings) MarshalJSON() ([]byte, error) {
 		OutputFormat:   c.OutputFormat,
 		DisablePreview: c.DisablePreviewImage,
 		BoomerModeOpts: c.BoomerModeOpts,
+		ShowOptions:    c.ShowOptions,
+		SnapToScene:    c.SnapToScene,
+		Playback:       c.Playback,
+		FrameOffset:    frameOffset,
+		Composition:    c.Composition,
+		TextBlocks:     c.TextBlocks,
+		ContactSheet:   c.ContactSheet,
 	})
 }
 
@@ -284,6 +340,43 @@ func (c *PreviewState) ApplyUpdate(upd StateUpdate) error {
 		}
 	case StateTogglePreview:
 		c.Settings.DisablePreviewImage = !c.Settings.DisablePreviewImage
+	case StateToggleOptions:
+		c.Settings.ShowOptions = !c.Settings.ShowOptions
+	case StateToggleSnapToScene:
+		c.Settings.SnapToScene = !c.Settings.SnapToScene
+	case StateToggleContactSheet:
+		c.Settings.ContactSheet = !c.Settings.ContactSheet
+	case StateSetPlaybackSpeed:
+		floatVal, ok := upd.Value.(float64)
+		if !ok {
+			return fmt.Errorf("%s was not expected type (wanted float64 got %T)", upd.Type, upd.Value)
+		}
+		c.Settings.Playback.Speed = floatVal
+	case StateTogglePlaybackReverse:
+		c.Settings.Playback.Reverse = !c.Settings.Playback.Reverse
+	case StateTogglePlaybackBoomerang:
+		c.Settings.Playback.Boomerang = !c.Settings.Playback.Boomerang
+	case StateSetFrameOffset:
+		//json decode will make this a float even if it's a whole number
+		floatVal, ok := upd.Value.(float64)
+		if !ok {
+			return fmt.Errorf("%s was not expected type (wanted float64 got %T)", upd.Type, upd.Value)
+		}
+		c.Settings.FrameOffset = util.ToPtr(time.Duration(floatVal))
+	case StateSetComposition:
+		if composition, ok := upd.Value.(CompositionOpts); !ok {
+			return fmt.Errorf("%s was not expected type (wanted CompositionOpts got %T)", upd.Type, upd.Value)
+		} else {
+			c.Settings.Composition = composition
+		}
+	case StateAddTextBlock:
+		if block, ok := upd.Value.(TextBlock); !ok {
+			return fmt.Errorf("%s was not expected type (wanted TextBlock got %T)", upd.Type, upd.Value)
+		} else {
+			c.Settings.TextBlocks = append(c.Settings.TextBlocks, block)
+		}
+	case StateClearTextBlocks:
+		c.Settings.TextBlocks = nil
 	case StateSetBoomerModeLayout:
 		if strVal, ok := upd.Value.(string); !ok {
 			return fmt.Errorf("%s was not expected type (wanted string got %T)", upd.Type, upd.Value)
@@ -358,6 +451,46 @@ func TogglePreview() StateUpdate {
 	return newStateUpdate(StateTogglePreview, nil)
 }
 
+func ToggleOptions() StateUpdate {
+	return newStateUpdate(StateToggleOptions, nil)
+}
+
+func ToggleSnapToScene() StateUpdate {
+	return newStateUpdate(StateToggleSnapToScene, nil)
+}
+
+func ToggleContactSheet() StateUpdate {
+	return newStateUpdate(StateToggleContactSheet, nil)
+}
+
+func StateSetSpeed(speed float64) StateUpdate {
+	return newStateUpdate(StateSetPlaybackSpeed, speed)
+}
+
+func ToggleReverse() StateUpdate {
+	return newStateUpdate(StateTogglePlaybackReverse, nil)
+}
+
+func ToggleBoomerang() StateUpdate {
+	return newStateUpdate(StateTogglePlaybackBoomerang, nil)
+}
+
+func StateSetStillFrameOffset(offset time.Duration) StateUpdate {
+	return newStateUpdate(StateSetFrameOffset, float64(offset))
+}
+
+func StateSetCompositionOpts(opts CompositionOpts) StateUpdate {
+	return newStateUpdate(StateSetComposition, opts)
+}
+
+func StateAddText(block TextBlock) StateUpdate {
+	return newStateUpdate(StateAddTextBlock, block)
+}
+
+func ClearTextBlocks() StateUpdate {
+	return newStateUpdate(StateClearTextBlocks, nil)
+}
+
 func SetBoomerModeLayout(layout string) StateUpdate {
 	return newStateUpdate(StateSetBoomerModeLayout, layout)
 }
@@ -385,3 +518,81 @@ func decodeUpdateStateAction(encoded string) (StateUpdate, error) {
 type BoomerModeOpts struct {
 	Layout string `json:"l,omitempty"`
 }
+
+type PlaybackOpts struct {
+	// Speed is a multiplier where zero means normal speed.
+	Speed     float64 `json:"s,omitempty"`
+	Reverse   bool    `json:"r,omitempty"`
+	Boomerang bool    `json:"b,omitempty"`
+}
+
+func (p PlaybackOpts) IsDefault() bool {
+	return p == PlaybackOpts{}
+}
+
+func (p PlaybackOpts) String() string {
+	labels := ""
+	if p.Speed != 0 && p.Speed != 1 {
+		labels += fmt.Sprintf("(%gx)", p.Speed)
+	}
+	if p.Reverse {
+		labels += "(reversed)"
+	}
+	if p.Boomerang {
+		labels += "(boomerang)"
+	}
+	return labels
+}
+
+type CompositionLayout string
+
+const (
+	CompositionSequence   CompositionLayout = ""
+	CompositionSideBySide CompositionLayout = "h"
+	CompositionStacked    CompositionLayout = "v"
+)
+
+func ParseCompositionLayout(str string) (CompositionLayout, error) {
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "", "sequence", "seq":
+		return CompositionSequence, nil
+	case "side-by-side", "side", "hstack", "h":
+		return CompositionSideBySide, nil
+	case "stacked", "stack", "vstack", "v":
+		return CompositionStacked, nil
+	}
+	return CompositionSequence, fmt.Errorf("unknown layout %s", str)
+}
+
+func (l CompositionLayout) String() string {
+	switch l {
+	case CompositionSideBySide:
+		return "side-by-side"
+	case CompositionStacked:
+		return "stacked"
+	default:
+		return "sequence"
+	}
+}
+
+// CompositionOpts are additional clips rendered along with the main clip.
+type CompositionOpts struct {
+	IDs    []string          `json:"i,omitempty"`
+	Layout CompositionLayout `json:"l,omitempty"`
+}
+
+func (c CompositionOpts) Enabled() bool {
+	return len(c.IDs) > 0
+}
+
+// TextBlock is a styled piece of text added in caption mode.
+type TextBlock struct {
+	Text string `json:"t"`
+	// Position is top, bottom, center or a pixel offset e.g. 10x20
+	Position string `json:"p,omitempty"`
+	Colour   string `json:"c,omitempty"`
+	Size     int    `json:"s,omitempty"`
+	// Start/End are seconds from the start of the clip. If End is zero the text is always visible.
+	Start float64 `json:"f,omitempty"`
+	End   float64 `json:"e,omitempty"`
+}
@@ -0,0 +1,101 @@
+package discord
+
+import (
+	"context"
+	"github.com/warmans/tvgif/pkg/discord/media"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// warmerInterval is how often the warmer checks for clips to render.
+const warmerInterval = time.Minute * 5
+
+// warmerIdleTime is how long the bot must have received no interactions before the warmer will run.
+const warmerIdleTime = time.Minute
+
+// maxRecentSearches is the number of recent search results that will be pre-rendered.
+const maxRecentSearches = 20
+
+// recentIDs is a fixed size list of unique media IDs, most recent first.
+type recentIDs struct {
+	lock sync.Mutex
+	ids  []string
+}
+
+func (r *recentIDs) Add(id string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.ids = slices.DeleteFunc(r.ids, func(v string) bool { return v == id })
+	r.ids = slices.Insert(r.ids, 0, id)
+	if len(r.ids) > maxRecentSearches {
+		r.ids = r.ids[:maxRecentSearches]
+	}
+}
+
+func (r *recentIDs) List() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return slices.Clone(r.ids)
+}
+
+// WarmCache periodically pre-renders the most requested clips and recent search results with default settings
+// so the first request is served from the cache. Nothing is rendered unless the bot is idle.
+func (b *Bot) WarmCache(ctx context.Context, topN int) {
+	ticker := time.NewTicker(warmerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.warmCache(ctx, topN)
+		}
+	}
+}
+
+func (b *Bot) warmCache(ctx context.Context, topN int) {
+	popular, err := b.srtStore.ListMostRequested(topN)
+	if err != nil {
+		b.logger.Error("Warmer failed to list popular clips", slog.String("err", err.Error()))
+		return
+	}
+
+	warmed := 0
+	seen := map[string]struct{}{}
+	for _, rawID := range append(b.recentSearches.List(), popular...) {
+		if _, ok := seen[rawID]; ok {
+			continue
+		}
+		seen[rawID] = struct{}{}
+		if ctx.Err() != nil || !b.isIdle() {
+			break
+		}
+		mediaID, err := media.ParseID(rawID)
+		if err != nil {
+			b.logger.Warn("Warmer skipped invalid ID", slog.String("id", rawID), slog.String("err", err.Error()))
+			continue
+		}
+		dialog, err := b.getDialogWithContext(mediaID)
+		if err != nil {
+			b.logger.Warn("Warmer skipped clip", slog.String("id", rawID), slog.String("err", err.Error()))
+			continue
+		}
+		// previews and posts with the default settings produce the same output so either can be served from the cache.
+		if _, err := b.renderFile(&PreviewState{ID: mediaID, Settings: defaultSetting()}, dialog.Dialog, true); err != nil {
+			b.logger.Warn("Warmer failed to render clip", slog.String("id", rawID), slog.String("err", err.Error()))
+			continue
+		}
+		warmed++
+	}
+	if warmed > 0 {
+		b.logger.Info("Warmed cache", slog.Int("clips", warmed))
+	}
+}
+
+func (b *Bot) isIdle() bool {
+	return time.Since(time.Unix(0, b.lastInteraction.Load())) > warmerIdleTime
+}
@@ -2,10 +2,13 @@ package importer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/fsnotify/fsnotify"
 	"github.com/jmoiron/sqlx"
+	"github.com/warmans/tvgif/pkg/align"
 	"github.com/warmans/tvgif/pkg/metadata"
+	"github.com/warmans/tvgif/pkg/model"
 	"github.com/warmans/tvgif/pkg/search"
 	"github.com/warmans/tvgif/pkg/store"
 	"log/slog"
@@ -20,6 +23,8 @@ const filePollingInterval = time.Second * 10
 type pendingFile struct {
 	srtFilePath string
 	modTime     time.Time
+	// reimport the file even if it has not changed e.g. because the episode offset changed.
+	reimport bool
 }
 
 func NewIncrementalImporter(
@@ -30,6 +35,8 @@ func NewIncrementalImporter(
 	searcher *search.BlugeSearch,
 	logger *slog.Logger,
 	useFilePolling bool,
+	aligner *align.Aligner,
+	subsLanguage string,
 ) *Incremental {
 	return &Incremental{
 		srtDir:         srtDir,
@@ -39,6 +46,10 @@ func NewIncrementalImporter(
 		searcher:       searcher,
 		logger:         logger,
 		useFilePolling: useFilePolling,
+		aligner:        aligner,
+		subsLanguage:   subsLanguage,
+		extractedSubs:  map[string]model.SubtitleStream{},
+		noSubs:         map[string]time.Time{},
 	}
 }
 
@@ -50,10 +61,24 @@ type Incremental struct {
 	searcher       *search.BlugeSearch
 	logger         *slog.Logger
 	useFilePolling bool
+	// aligner is optional, if set subtitles will be aligned to the audio before being imported.
+	aligner *align.Aligner
+	// subsLanguage is the preferred language (e.g. eng) of subtitles extracted from videos with no SRT.
+	// If empty subtitles are not extracted.
+	subsLanguage string
+	// extractedSubs are the streams used to create SRTs (keyed by SRT path). Persisted in the var dir.
+	extractedSubs map[string]model.SubtitleStream
+	// noSubs are the videos (and their mod times) that subtitles could not be extracted from. Persisted in the var dir.
+	noSubs map[string]time.Time
 }
 
 func (i *Incremental) Start(ctx context.Context) error {
 
+	if err := i.loadSubsState(); err != nil {
+		// the worst case is that failed videos are probed again.
+		i.logger.Warn("Failed to load extracted subtitles state", slog.String("err", err.Error()))
+	}
+
 	i.logger.Info("Starting initial file sync...")
 	if err := i.importAllNew(ctx); err != nil {
 		return err
@@ -95,16 +120,20 @@ func (i *Incremental) startFileWatch(ctx context.Context) error {
 			case <-ctx.Done():
 				return
 			case event, ok := <-watcher.Events:
-				if !ok || !strings.HasSuffix(event.Name, ".srt") {
+				if !ok {
 					return
 				}
+				// the media dir also contains videos, their subtitles are extracted on the next tick.
+				if !strings.HasSuffix(event.Name, ".srt") {
+					continue
+				}
 				if event.Has(fsnotify.Create) {
 					stat, err := os.Stat(event.Name)
 					if err != nil {
 						i.logger.Error("failed stat file", slog.String("err", err.Error()))
 						continue
 					}
-					pendingFiles = append(pendingFiles, pendingFile{srtFilePath: event.Name, modTime: stat.ModTime()})
+					pendingFiles = append(pendingFiles, pendingFile{srtFilePath: event.Name, modTime: metadata.SourceModTime(event.Name, stat.ModTime())})
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
@@ -112,15 +141,8 @@ func (i *Incremental) startFileWatch(ctx context.Context) error {
 				}
 				i.logger.Info("error", slog.String("err", err.Error()))
 			case <-ticker.C:
-				if len(pendingFiles) > 0 {
-					if err := i.importNewSRT(ctx, pendingFiles); err != nil {
-						i.logger.Error(
-							"Failed to import pending files",
-							slog.String("err", err.Error()),
-						)
-					}
-					pendingFiles = []pendingFile{}
-				}
+				i.importPending(ctx, pendingFiles)
+				pendingFiles = []pendingFile{}
 			}
 		}
 	}()
@@ -136,7 +158,38 @@ func (i *Incremental) startFileWatch(ctx context.Context) error {
 	return nil
 }
 
+// importPending is run periodically in watch mode. New videos are checked for subtitles first since the extracted
+// SRTs will be picked up by the watcher.
+func (i *Incremental) importPending(ctx context.Context, pendingFiles []pendingFile) {
+	if i.subsLanguage != "" {
+		if err := i.extractMissingSubs(ctx); err != nil {
+			i.logger.Error("Failed to extract subtitles", slog.String("err", err.Error()))
+		}
+	}
+	if err := i.importQueued(ctx); err != nil {
+		i.logger.Error("Failed to import queued episodes", slog.String("err", err.Error()))
+	}
+	if len(pendingFiles) > 0 {
+		if err := i.importNewSRT(ctx, pendingFiles); err != nil {
+			i.logger.Error(
+				"Failed to import pending files",
+				slog.String("err", err.Error()),
+			)
+		}
+	}
+}
+
 func (i *Incremental) importAllNew(ctx context.Context) error {
+	if i.subsLanguage != "" {
+		if err := i.extractMissingSubs(ctx); err != nil {
+			i.logger.Error("Failed to extract subtitles", slog.String("err", err.Error()))
+		}
+	}
+
+	if err := i.importQueued(ctx); err != nil {
+		i.logger.Error("Failed to import queued episodes", slog.String("err", err.Error()))
+	}
+
 	manifest, err := store.NewSRTStore(i.conn.Db).GetManifest()
 	if err != nil {
 		return err
@@ -156,13 +209,14 @@ func (i *Incremental) importAllNew(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+		modTime := metadata.SourceModTime(path.Join(i.srtDir, v.Name()), inf.ModTime())
 		addToImport := false
 		if oldModTime, ok := manifest[path.Join(i.srtDir, v.Name())]; ok {
-			if inf.ModTime().After(oldModTime) {
+			if modTime.After(oldModTime) {
 				i.logger.Info("file older than existing",
 					slog.String("path", path.Join(i.srtDir, v.Name())),
 					slog.Time("old", oldModTime),
-					slog.Time("new", inf.ModTime()),
+					slog.Time("new", modTime),
 				)
 				addToImport = true
 			}
@@ -170,7 +224,7 @@ func (i *Incremental) importAllNew(ctx context.Context) error {
 			addToImport = true
 		}
 		if addToImport {
-			toImport = append(toImport, pendingFile{srtFilePath: path.Join(i.srtDir, v.Name()), modTime: inf.ModTime()})
+			toImport = append(toImport, pendingFile{srtFilePath: path.Join(i.srtDir, v.Name()), modTime: modTime})
 		}
 	}
 	if len(toImport) == 0 {
@@ -190,19 +244,62 @@ func (i *Incremental) importAllNew(ctx context.Context) error {
 func (i *Incremental) importNewSRT(ctx context.Context, pendingFiles []pendingFile) error {
 
 	for k, pending := range pendingFiles {
-		err := i.conn.WithTx(func(tx *sqlx.Tx) error {
-			meta, err := metadata.CreateMetadataFromSRT(pending.srtFilePath, i.metadataDir, i.varDir)
+		if !pending.reimport {
+			// checked before the metadata is created since aligning an unchanged file would be a waste of time.
+			unchanged, err := store.NewSRTStore(i.conn.Db).ManifestUnchanged(pending.srtFilePath, pending.modTime)
 			if err != nil {
-				return fmt.Errorf("failed to create metadata: %w", err)
+				return fmt.Errorf("failed to check manifest: %w", err)
 			}
-			logger := i.logger.With(slog.String("episode_id", meta.ID()), slog.Time("modtime", pending.modTime))
+			if unchanged {
+				i.logger.Info("File already processed, skipped", slog.String("path", pending.srtFilePath))
+				continue
+			}
+		}
+		meta, err := metadata.CreateMetadataFromSRT(pending.srtFilePath, i.metadataDir, i.varDir, i.logger)
+		if err != nil {
+			// one bad file should not block the rest of the import. It will be retried on the next sync.
+			i.logger.Error("Failed to create metadata, file skipped", slog.String("path", pending.srtFilePath), slog.String("err", err.Error()))
+			continue
+		}
+		logger := i.logger.With(slog.String("episode_id", meta.ID()), slog.Time("modtime", pending.modTime))
 
+		metaChanged := false
+		if stream, ok := i.extractedSubs[pending.srtFilePath]; ok {
+			meta.Meta = &model.EpisodeMeta{
+				SourceSRTName:    path.Base(pending.srtFilePath),
+				SourceSRTModTime: pending.modTime,
+				SubtitleStream:   &stream,
+			}
+			metaChanged = true
+		}
+		// this is done outside the transaction since it can take some time.
+		if i.aligner != nil && i.alignEpisode(ctx, logger, path.Dir(pending.srtFilePath), meta) {
+			metaChanged = true
+		}
+		// the offset is a manual correction of the final timestamps so is applied after the alignment.
+		offset, err := store.NewSRTStore(i.conn.Db).GetEpisodeOffset(meta.Publication, meta.Series, meta.Episode)
+		if err != nil {
+			// importing without the offset would lose the correction so the file is skipped instead.
+			logger.Error("Failed to get episode offset, file skipped", slog.String("err", err.Error()))
+			continue
+		}
+		if !offset.IsZero() {
+			meta.Dialog, meta.Offset = offset.Apply(meta.Dialog), &offset
+			metaChanged = true
+		}
+		if metaChanged {
+			if err := metadata.SaveMetadata(i.metadataDir, meta); err != nil {
+				return err
+			}
+		}
+
+		err = i.conn.WithTx(func(tx *sqlx.Tx) error {
 			s := store.NewSRTStore(tx)
 			result, err := s.ManifestAdd(pending.srtFilePath, pending.modTime)
 			if err != nil {
 				return fmt.Errorf("failed to add to manifest: %w", err)
 			}
-			if result == store.UpsertResultNoop {
+			if result == store.UpsertResultNoop && !pending.reimport {
 				// nothing to do
 				logger.Info("File already processed, skipped")
 				return nil
@@ -213,7 +310,7 @@ func (i *Incremental) importNewSRT(ctx context.Context, pendingFiles []pendingFi
 			}
 
 			logger.Info("Import to index...", slog.String("result", string(result)), slog.Float64("progress", float64(k)/float64(len(pendingFiles))*100))
-			return i.searcher.Import(ctx, meta, result == store.UpsertResultUpdated)
+			return i.searcher.Import(ctx, meta, result == store.UpsertResultUpdated || pending.reimport)
 		})
 		if err != nil {
 			return err
@@ -226,3 +323,66 @@ func (i *Incremental) importNewSRT(ctx context.Context, pendingFiles []pendingFi
 	}
 	return i.searcher.RefreshIndex()
 }
+
+// importQueued re-imports the episodes queued by the store e.g. because their offset was changed.
+func (i *Incremental) importQueued(ctx context.Context) error {
+	s := store.NewSRTStore(i.conn.Db)
+	episodeIDs, err := s.ListQueuedReimports()
+	if err != nil {
+		return err
+	}
+	if len(episodeIDs) == 0 {
+		return nil
+	}
+	toImport := []pendingFile{}
+	claimed := []string{}
+	for _, episodeID := range episodeIDs {
+		// the episode is removed from the queue before it is imported so if it is queued again during the import
+		// it will be imported again.
+		if err := s.RemoveQueuedReimport(episodeID); err != nil {
+			return err
+		}
+		meta, err := metadata.LoadMetadata(i.metadataDir, episodeID)
+		if err != nil {
+			// if the episode has not been imported yet any changes will be applied when it is.
+			if !errors.Is(err, os.ErrNotExist) {
+				i.logger.Warn("Failed to load metadata for queued episode", slog.String("episode_id", episodeID), slog.String("err", err.Error()))
+			}
+			continue
+		}
+		srtFilePath := path.Join(i.srtDir, meta.SRTFile)
+		stat, err := os.Stat(srtFilePath)
+		if err != nil {
+			i.logger.Warn("Failed to stat SRT for queued episode", slog.String("episode_id", episodeID), slog.String("err", err.Error()))
+			continue
+		}
+		toImport = append(toImport, pendingFile{srtFilePath: srtFilePath, modTime: metadata.SourceModTime(srtFilePath, stat.ModTime()), reimport: true})
+		claimed = append(claimed, episodeID)
+	}
+
+	if len(toImport) > 0 {
+		i.logger.Info("Re-importing queued episodes...", slog.Int("num_episodes", len(toImport)))
+		if err := i.importNewSRT(ctx, toImport); err != nil {
+			// queue the episodes again so the import is retried.
+			for _, episodeID := range claimed {
+				if err := s.QueueReimport(episodeID); err != nil {
+					i.logger.Error("Failed to re-queue episode", slog.String("episode_id", episodeID), slog.String("err", err.Error()))
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// alignEpisode corrects the dialog timestamps of the episode using the audio. On failure the original
+// timestamps are retained and false is returned.
+func (i *Incremental) alignEpisode(ctx context.Context, logger *slog.Logger, mediaDir string, meta *model.Episode) bool {
+	dialog, alignment, err := i.aligner.Align(ctx, path.Join(mediaDir, meta.VideoFile), meta.Dialog)
+	if err != nil {
+		logger.Warn("Failed to align subtitles, original timestamps will be used", slog.String("err", err.Error()))
+		return false
+	}
+	meta.Dialog, meta.Alignment = dialog, alignment
+	return true
+}
@@ -0,0 +1,253 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/warmans/tvgif/pkg/metadata"
+	"github.com/warmans/tvgif/pkg/model"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// minVideoAge prevents extracting subs from a video that is still being copied into the media dir. It is only a
+// guess so a copy that stalls for longer could still be extracted early.
+const minVideoAge = time.Minute
+
+// subsStateFile is kept in the var dir so extracted streams and failed videos are remembered after a restart.
+const subsStateFile = "extracted_subs.json"
+
+type subsState struct {
+	Extracted map[string]model.SubtitleStream `json:"extracted"`
+	NoSubs    map[string]time.Time            `json:"no_subs"`
+}
+
+// textSubtitleCodecs can be converted to SRT. Image based subtitles (e.g. PGS, VOBSUB) would require OCR.
+var textSubtitleCodecs = []string{"subrip", "srt", "ass", "ssa", "mov_text", "webvtt", "text"}
+
+type probedStream struct {
+	Index       int    `json:"index"`
+	CodecName   string `json:"codec_name"`
+	Disposition struct {
+		Forced int `json:"forced"`
+	} `json:"disposition"`
+	Tags struct {
+		Language string `json:"language"`
+		Title    string `json:"title"`
+	} `json:"tags"`
+}
+
+// extractMissingSubs creates an SRT for each video that doesn't have one from the video's own subtitle streams.
+func (i *Incremental) extractMissingSubs(ctx context.Context) error {
+	dirEntries, err := os.ReadDir(i.srtDir)
+	if err != nil {
+		return err
+	}
+	existing := map[string]struct{}{}
+	for _, v := range dirEntries {
+		if strings.HasSuffix(v.Name(), ".srt") {
+			existing[strings.TrimSuffix(v.Name(), ".srt")] = struct{}{}
+		}
+	}
+	changed := false
+	defer func() {
+		if !changed {
+			return
+		}
+		if err := i.saveSubsState(); err != nil {
+			i.logger.Error("Failed to save extracted subtitles state", slog.String("err", err.Error()))
+		}
+	}()
+	for _, v := range dirEntries {
+		if v.IsDir() || !metadata.IsVideoFile(v.Name()) {
+			continue
+		}
+		baseName := strings.TrimSuffix(v.Name(), path.Ext(v.Name()))
+		if _, ok := existing[baseName]; ok {
+			continue
+		}
+		info, err := v.Info()
+		if err != nil || time.Since(info.ModTime()) < minVideoAge {
+			continue
+		}
+		videoPath := path.Join(i.srtDir, v.Name())
+		if i.noSubs[videoPath].Equal(info.ModTime()) {
+			continue
+		}
+		logger := i.logger.With(slog.String("video", v.Name()))
+
+		stream, err := ExtractSubs(ctx, videoPath, path.Join(i.srtDir, baseName+".srt"), i.subsLanguage)
+		changed = true
+		if err != nil {
+			// don't try again unless the file changes
+			i.noSubs[videoPath] = info.ModTime()
+			logger.Warn("Failed to extract subtitles", slog.String("err", err.Error()))
+			continue
+		}
+		// SRT names always match the video name so this can be used during import.
+		i.extractedSubs[path.Join(i.srtDir, baseName+".srt")] = *stream
+		logger.Info("Extracted subtitles", slog.Int("stream", stream.Index), slog.String("language", stream.Language))
+	}
+	return nil
+}
+
+// loadSubsState restores the extracted streams and failed videos from the var dir. Entries for files that no
+// longer exist are dropped.
+func (i *Incremental) loadSubsState() error {
+	data, err := os.ReadFile(path.Join(i.varDir, subsStateFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	state := subsState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", subsStateFile, err)
+	}
+	for srtPath, stream := range state.Extracted {
+		if _, err := os.Stat(srtPath); err == nil {
+			i.extractedSubs[srtPath] = stream
+		}
+	}
+	for videoPath, modTime := range state.NoSubs {
+		if _, err := os.Stat(videoPath); err == nil {
+			i.noSubs[videoPath] = modTime
+		}
+	}
+	return nil
+}
+
+// saveSubsState replaces the state file. It is written to a temp file first so it can't be left partially written.
+func (i *Incremental) saveSubsState() error {
+	data, err := json.MarshalIndent(subsState{Extracted: i.extractedSubs, NoSubs: i.noSubs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(i.varDir, ".extracted-subs-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmpFile.Name())
+	}()
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path.Join(i.varDir, subsStateFile))
+}
+
+// ExtractSubs converts the best subtitle stream in the video to an SRT.
+func ExtractSubs(ctx context.Context, videoPath string, srtPath string, language string) (*model.SubtitleStream, error) {
+	streams, err := probeSubtitleStreams(ctx, videoPath)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := chooseSubtitleStream(streams, language)
+	if !ok {
+		return nil, fmt.Errorf("no suitable subtitle stream found (%d subtitle streams)", len(streams))
+	}
+
+	// the SRT is written to a temp file first so the importer can never see a partial file.
+	tmpFile, err := os.CreateTemp(path.Dir(srtPath), ".extract-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	tmpFile.Close()
+	defer func() {
+		_ = os.Remove(tmpFile.Name())
+	}()
+
+	out := &bytes.Buffer{}
+	cmd := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		"-nostdin",
+		"-v", "error",
+		"-y",
+		"-i", videoPath,
+		"-map", fmt.Sprintf("0:%d", stream.Index),
+		"-c:s", "srt",
+		"-f", "srt",
+		tmpFile.Name(),
+	)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(out.String()))
+	}
+	if err := os.Rename(tmpFile.Name(), srtPath); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func probeSubtitleStreams(ctx context.Context, videoPath string) ([]probedStream, error) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(
+		ctx,
+		"ffprobe",
+		"-v", "error",
+		"-select_streams", "s",
+		"-show_entries", "stream=index,codec_name:stream_disposition=forced:stream_tags=language,title",
+		"-of", "json",
+		videoPath,
+	)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	result := struct {
+		Streams []probedStream `json:"streams"`
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("failed to decode ffprobe output: %w", err)
+	}
+	return result.Streams, nil
+}
+
+// chooseSubtitleStream picks the full (i.e. not forced) text stream in the given language. If there
+// isn't one a forced stream or a stream with no language is used instead.
+func chooseSubtitleStream(streams []probedStream, language string) (*model.SubtitleStream, bool) {
+	var best *probedStream
+	bestScore := 0
+	for k, v := range streams {
+		if !slices.Contains(textSubtitleCodecs, v.CodecName) {
+			continue
+		}
+		score := 0
+		switch v.Tags.Language {
+		case language:
+			score = 3
+			if v.Disposition.Forced == 1 {
+				score = 2
+			}
+		case "", "und":
+			score = 1
+		}
+		if score > bestScore {
+			best, bestScore = &streams[k], score
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return &model.SubtitleStream{
+		Index:    best.Index,
+		Codec:    best.CodecName,
+		Language: best.Tags.Language,
+		Title:    best.Tags.Title,
+	}, true
+}
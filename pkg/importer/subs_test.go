@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/warmans/tvgif/pkg/model"
+	"github.com/warmans/tvgif/pkg/store"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func stream(index int, codec string, language string, forced bool) probedStream {
+	s := probedStream{Index: index, CodecName: codec}
+	s.Tags.Language = language
+	if forced {
+		s.Disposition.Forced = 1
+	}
+	return s
+}
+
+func TestChooseSubtitleStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		streams   []probedStream
+		wantIndex int
+		wantOK    bool
+	}{
+		{
+			name:    "no streams",
+			streams: []probedStream{},
+		},
+		{
+			name:      "preferred language",
+			streams:   []probedStream{stream(2, "subrip", "fre", false), stream(3, "subrip", "eng", false)},
+			wantIndex: 3,
+			wantOK:    true,
+		},
+		{
+			name:      "forced is only used if there is no full stream",
+			streams:   []probedStream{stream(2, "subrip", "eng", true), stream(3, "ass", "eng", false), stream(4, "subrip", "eng", false)},
+			wantIndex: 3,
+			wantOK:    true,
+		},
+		{
+			name:      "untagged",
+			streams:   []probedStream{stream(2, "subrip", "fre", false), stream(3, "mov_text", "", false)},
+			wantIndex: 3,
+			wantOK:    true,
+		},
+		{
+			name:    "image subs are not supported",
+			streams: []probedStream{stream(2, "hdmv_pgs_subtitle", "eng", false)},
+		},
+		{
+			name:    "other languages are not used",
+			streams: []probedStream{stream(2, "subrip", "fre", false)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := chooseSubtitleStream(tt.streams, "eng")
+			require.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				require.Equal(t, tt.wantIndex, got.Index)
+			}
+		})
+	}
+}
+
+func TestSubsState(t *testing.T) {
+	mediaDir, varDir := t.TempDir(), t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	srtPath := path.Join(mediaDir, "peepshow-S01E01.srt")
+	videoPath := path.Join(mediaDir, "peepshow-S01E02.mkv")
+	require.NoError(t, os.WriteFile(srtPath, []byte{}, 0644))
+	require.NoError(t, os.WriteFile(videoPath, []byte{}, 0644))
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	imp := NewIncrementalImporter(mediaDir, "", varDir, nil, nil, logger, true, nil, "eng")
+	imp.extractedSubs[srtPath] = model.SubtitleStream{Index: 2, Codec: "subrip", Language: "eng"}
+	imp.noSubs[videoPath] = modTime
+	// files that have since been removed should not be restored.
+	imp.noSubs[path.Join(mediaDir, "removed.mkv")] = modTime
+	require.NoError(t, imp.saveSubsState())
+
+	restored := NewIncrementalImporter(mediaDir, "", varDir, nil, nil, logger, true, nil, "eng")
+	require.NoError(t, restored.loadSubsState())
+	require.Equal(t, map[string]model.SubtitleStream{srtPath: {Index: 2, Codec: "subrip", Language: "eng"}}, restored.extractedSubs)
+	require.Equal(t, map[string]time.Time{videoPath: modTime}, restored.noSubs)
+
+	// no state file is not an error.
+	empty := NewIncrementalImporter(mediaDir, "", t.TempDir(), nil, nil, logger, true, nil, "eng")
+	require.NoError(t, empty.loadSubsState())
+	require.Empty(t, empty.noSubs)
+}
+
+func TestImportPending_NewVideo(t *testing.T) {
+	mediaDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	conn, err := store.NewConn(&store.Config{DSN: "file:" + path.Join(t.TempDir(), "db.sqlite")})
+	require.NoError(t, err)
+	require.NoError(t, conn.Migrate())
+
+	imp := NewIncrementalImporter(mediaDir, "", t.TempDir(), conn, nil, logger, false, nil, "eng")
+	require.NoError(t, imp.importAllNew(context.Background()))
+
+	// the video arrives after startup, it is not a real video so extraction fails but it should still be attempted.
+	videoPath := path.Join(mediaDir, "peepshow-S01E01.mkv")
+	require.NoError(t, os.WriteFile(videoPath, []byte{}, 0644))
+	modTime := time.Now().Add(-minVideoAge * 2).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(videoPath, modTime, modTime))
+
+	imp.importPending(context.Background(), nil)
+	require.Contains(t, imp.noSubs, videoPath)
+	require.True(t, imp.noSubs[videoPath].Equal(modTime))
+}
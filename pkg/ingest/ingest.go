@@ -0,0 +1,332 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/warmans/tvgif/pkg/importer"
+	"github.com/warmans/tvgif/pkg/util"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processedDir is where source files are moved once they have been ingested. It is relative to the inbox.
+const processedDir = ".processed"
+
+// minSourceAge prevents processing files that are still being copied into the inbox.
+const minSourceAge = time.Minute
+
+// maxAspectDifference is how different the source aspect ratio can be from the target before it is
+// padded (e.g. 4:3 sources) instead of being stretched.
+const maxAspectDifference = 0.05
+
+var sourceExtensions = []string{".mp4", ".mkv", ".avi", ".webm", ".mov", ".m4v", ".mpg", ".wmv"}
+
+var publicationRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+type Config struct {
+	InboxDir string
+	MediaDir string
+	// DefaultPublication is used for files in the root of the inbox. Otherwise, the name of the sub-dir is used.
+	DefaultPublication string
+	Width              int
+	Height             int
+	FPS                int
+	KeepAudio          bool
+	// SubsLanguage is the preferred language of subtitles extracted from sources with no SRT.
+	SubsLanguage string
+}
+
+func NewIngester(cfg Config, jobLog *JobLog, logger *slog.Logger) *Ingester {
+	return &Ingester{cfg: cfg, jobLog: jobLog, logger: logger.With(slog.String("component", "ingest"))}
+}
+
+// Ingester replaces the scripts used to prepare videos. It renames, transcodes and extracts subtitles from
+// files in the inbox then moves them into the media dir to be imported by the bot.
+type Ingester struct {
+	cfg    Config
+	jobLog *JobLog
+	logger *slog.Logger
+}
+
+// Run processes the inbox at the given interval until the context is cancelled.
+func (i *Ingester) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := i.ProcessInbox(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessInbox ingests all the files currently in the inbox.
+func (i *Ingester) ProcessInbox(ctx context.Context) error {
+	sources, err := i.findSources()
+	if err != nil {
+		return fmt.Errorf("failed to list inbox: %w", err)
+	}
+	for _, source := range sources {
+		if ctx.Err() != nil {
+			return nil
+		}
+		info, err := os.Stat(path.Join(i.cfg.InboxDir, source))
+		if err != nil || time.Since(info.ModTime()) < minSourceAge {
+			continue
+		}
+		if job, ok := i.jobLog.Get(source); ok && job.Finished(info.ModTime()) {
+			continue
+		}
+		job := Job{Source: source, SourceModTime: info.ModTime(), Status: JobStatusStarted}
+		if err := i.jobLog.Record(job); err != nil {
+			return err
+		}
+
+		logger := i.logger.With(slog.String("source", source))
+		logger.Info("Ingesting file...")
+
+		job.Target, err = i.ingest(ctx, source)
+		if err != nil {
+			if ctx.Err() != nil {
+				// leave the job as started so that it is resumed next time.
+				return nil
+			}
+			logger.Error("Ingest failed", slog.String("err", err.Error()))
+			job.Status, job.Error = JobStatusFailed, err.Error()
+		} else {
+			logger.Info("Ingest complete", slog.String("target", job.Target))
+			job.Status = JobStatusDone
+		}
+		if err := i.jobLog.Record(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findSources lists the videos in the inbox and publication sub-dirs, relative to the inbox.
+func (i *Ingester) findSources() ([]string, error) {
+	sources := []string{}
+	err := filepath.WalkDir(i.cfg.InboxDir, func(filePath string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(i.cfg.InboxDir, filePath)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if relPath != "." && (strings.HasPrefix(d.Name(), ".") || strings.Contains(relPath, string(filepath.Separator))) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if slices.Contains(sourceExtensions, strings.ToLower(path.Ext(d.Name()))) {
+			sources = append(sources, relPath)
+		}
+		return nil
+	})
+	return sources, err
+}
+
+func (i *Ingester) ingest(ctx context.Context, source string) (string, error) {
+	sourcePath := path.Join(i.cfg.InboxDir, source)
+
+	publication := i.cfg.DefaultPublication
+	if dir := path.Dir(source); dir != "." {
+		publication = dir
+	}
+	target, err := targetName(publication, path.Base(source))
+	if err != nil {
+		return "", err
+	}
+	videoPath := path.Join(i.cfg.MediaDir, target+".webm")
+	srtPath := path.Join(i.cfg.MediaDir, target+".srt")
+	if _, err := os.Stat(videoPath); err == nil {
+		return target, fmt.Errorf("%s already exists in the media dir", path.Base(videoPath))
+	}
+
+	// files are written to temp files and moved into place at the end so the bot never sees partial files.
+	tmpVideoPath := path.Join(i.cfg.MediaDir, fmt.Sprintf(".ingest-%s.webm.tmp", target))
+	tmpSRTPath := path.Join(i.cfg.MediaDir, fmt.Sprintf(".ingest-%s.srt.tmp", target))
+	defer func() {
+		_ = os.Remove(tmpVideoPath)
+		_ = os.Remove(tmpSRTPath)
+	}()
+
+	// subs are done first since there's no point transcoding a video with no subs.
+	sourceSRTPath := strings.TrimSuffix(sourcePath, path.Ext(sourcePath)) + ".srt"
+	if _, err := os.Stat(sourceSRTPath); err == nil {
+		if err := copyFile(sourceSRTPath, tmpSRTPath); err != nil {
+			return target, fmt.Errorf("failed to copy srt: %w", err)
+		}
+	} else {
+		if _, err := importer.ExtractSubs(ctx, sourcePath, tmpSRTPath, i.cfg.SubsLanguage); err != nil {
+			return target, fmt.Errorf("no srt was found and subtitles could not be extracted: %w", err)
+		}
+	}
+
+	if err := i.transcode(ctx, sourcePath, tmpVideoPath); err != nil {
+		return target, err
+	}
+
+	// the video must be moved first since the SRT triggers the import.
+	if err := os.Rename(tmpVideoPath, videoPath); err != nil {
+		return target, err
+	}
+	if err := os.Rename(tmpSRTPath, srtPath); err != nil {
+		// the video must not be left without its SRT or the importer may try to extract subs from it.
+		if rmErr := os.Remove(videoPath); rmErr != nil {
+			i.logger.Error("Failed to remove video", slog.String("path", videoPath), slog.String("err", rmErr.Error()))
+		}
+		return target, err
+	}
+
+	return target, i.moveToProcessed(source, sourceSRTPath)
+}
+
+func (i *Ingester) transcode(ctx context.Context, sourcePath string, outputPath string) error {
+	aspect, err := probeAspectRatio(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	args := []string{"-nostdin", "-v", "error", "-y", "-i", sourcePath}
+	if !i.cfg.KeepAudio {
+		args = append(args, "-an")
+	}
+	args = append(args, "-vf", videoFilter(i.cfg, aspect), "-f", "webm", outputPath)
+
+	out := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
+
+// moveToProcessed moves the source (and SRT, if there was one) out of the inbox.
+func (i *Ingester) moveToProcessed(source string, sourceSRTPath string) error {
+	processedPath := path.Join(i.cfg.InboxDir, processedDir, source)
+	if err := os.MkdirAll(path.Dir(processedPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(path.Join(i.cfg.InboxDir, source), processedPath); err != nil {
+		return fmt.Errorf("failed to move source to %s: %w", processedDir, err)
+	}
+	if err := os.Rename(sourceSRTPath, path.Join(path.Dir(processedPath), path.Base(sourceSRTPath))); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to move srt to %s: %w", processedDir, err)
+	}
+	return nil
+}
+
+// targetName creates the name expected by the importer e.g. peepshow-S01E01
+func targetName(publication string, fileName string) (string, error) {
+	if !publicationRegex.MatchString(publication) {
+		return "", fmt.Errorf("invalid publication '%s': must be alphanumeric or hyphens (files in the root of the inbox need a default publication)", publication)
+	}
+	series, episode, err := util.ParseSeriesAndEpisodeFromAnyFileName(fileName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s", strings.ToLower(publication), util.FormatSeriesAndEpisode(int(series), int(episode))), nil
+}
+
+// videoFilter scales the video to the target size. Sources with a different aspect ratio are padded.
+func videoFilter(cfg Config, sourceAspect float64) string {
+	targetAspect := float64(cfg.Width) / float64(cfg.Height)
+	if math.Abs(sourceAspect-targetAspect)/targetAspect > maxAspectDifference {
+		return fmt.Sprintf(
+			"fps=%d,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:-1:-1:color=black,setsar=1",
+			cfg.FPS, cfg.Width, cfg.Height, cfg.Width, cfg.Height,
+		)
+	}
+	return fmt.Sprintf("fps=%d,scale=%d:%d,setsar=1", cfg.FPS, cfg.Width, cfg.Height)
+}
+
+// probeAspectRatio gets the display aspect ratio of the first video stream.
+func probeAspectRatio(ctx context.Context, videoPath string) (float64, error) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(
+		ctx,
+		"ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height,sample_aspect_ratio",
+		"-of", "json",
+		videoPath,
+	)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	result := struct {
+		Streams []struct {
+			Width             int    `json:"width"`
+			Height            int    `json:"height"`
+			SampleAspectRatio string `json:"sample_aspect_ratio"`
+		} `json:"streams"`
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return 0, fmt.Errorf("failed to decode ffprobe output: %w", err)
+	}
+	if len(result.Streams) == 0 || result.Streams[0].Height == 0 {
+		return 0, fmt.Errorf("no video stream found")
+	}
+	stream := result.Streams[0]
+	return float64(stream.Width) / float64(stream.Height) * parseRatio(stream.SampleAspectRatio), nil
+}
+
+// parseRatio parses ratios like 16:15. Anything invalid is treated as 1 (i.e. square pixels).
+func parseRatio(raw string) float64 {
+	num, den, ok := strings.Cut(raw, ":")
+	if !ok {
+		return 1
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n <= 0 {
+		return 1
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d <= 0 {
+		return 1
+	}
+	return n / d
+}
+
+func copyFile(from string, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,103 @@
+package ingest
+
+import (
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestJobLog(t *testing.T) {
+	logPath := path.Join(t.TempDir(), "jobs.jsonl")
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	jobLog, err := OpenJobLog(logPath)
+	require.NoError(t, err)
+	require.NoError(t, jobLog.Record(Job{Source: "peepshow/S01E01.mkv", SourceModTime: modTime, Status: JobStatusStarted}))
+	require.NoError(t, jobLog.Record(Job{Source: "peepshow/S01E01.mkv", SourceModTime: modTime, Status: JobStatusDone, Target: "peepshow-S01E01"}))
+	require.NoError(t, jobLog.Record(Job{Source: "peepshow/S01E02.mkv", SourceModTime: modTime, Status: JobStatusStarted}))
+
+	// simulate the process being killed during a write.
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"source":"peepshow/S01E02.mkv","sta`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	replayed, err := OpenJobLog(logPath)
+	require.NoError(t, err)
+
+	job, ok := replayed.Get("peepshow/S01E01.mkv")
+	require.True(t, ok)
+	require.Equal(t, "peepshow-S01E01", job.Target)
+	require.True(t, job.Finished(modTime))
+	require.False(t, job.Finished(modTime.Add(time.Second)), "changed files should be re-processed")
+
+	job, ok = replayed.Get("peepshow/S01E02.mkv")
+	require.True(t, ok)
+	require.False(t, job.Finished(modTime), "interrupted jobs should be resumed")
+}
+
+func TestTargetName(t *testing.T) {
+	tests := []struct {
+		publication string
+		fileName    string
+		want        string
+		wantErr     bool
+	}{
+		{publication: "peepshow", fileName: "Peep Show S01E02 - Jeremy's Van.mkv", want: "peepshow-S01E02"},
+		{publication: "PeepShow", fileName: "Peep Show - Season 1 Episode 2.mkv", want: "peepshow-S01E02"},
+		{publication: "simpsons", fileName: "The Simpsons - 10x01 - Lard of the Dance.mkv", want: "simpsons-S10E01"},
+		{publication: "the-office", fileName: "The Office S02E03.mkv", want: "the-office-S02E03"},
+		{publication: "peepshow", fileName: "Peep Show.mkv", wantErr: true},
+		{publication: "", fileName: "S01E01.mkv", wantErr: true},
+		{publication: "peep show", fileName: "S01E01.mkv", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			got, err := targetName(tt.publication, tt.fileName)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestVideoFilter(t *testing.T) {
+	cfg := Config{Width: 596, Height: 336, FPS: 10}
+	require.Equal(t, "fps=10,scale=596:336,setsar=1", videoFilter(cfg, 16.0/9))
+	require.Equal(
+		t,
+		"fps=10,scale=596:336:force_original_aspect_ratio=decrease,pad=596:336:-1:-1:color=black,setsar=1",
+		videoFilter(cfg, 4.0/3),
+	)
+	// anamorphic PAL DVD
+	require.InDelta(t, 16.0/9, 720.0/576*parseRatio("64:45"), 0.001)
+}
+
+func TestFindSources(t *testing.T) {
+	inbox := t.TempDir()
+	for _, name := range []string{
+		"S01E01.mkv",
+		"peepshow/S01E02.mp4",
+		"peepshow/S01E02.srt",
+		"peepshow/extras/S01E03.mp4",
+		".processed/peepshow/S01E04.mp4",
+	} {
+		require.NoError(t, os.MkdirAll(path.Dir(path.Join(inbox, name)), 0755))
+		require.NoError(t, os.WriteFile(path.Join(inbox, name), []byte{}, 0644))
+	}
+	sources, err := NewIngester(Config{InboxDir: inbox}, nil, testLogger()).findSources()
+	require.NoError(t, err)
+	require.Equal(t, []string{"S01E01.mkv", "peepshow/S01E02.mp4"}, sources)
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
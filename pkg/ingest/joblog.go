@@ -0,0 +1,97 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobStatusStarted JobStatus = "started"
+	JobStatusDone    JobStatus = "done"
+	JobStatusFailed  JobStatus = "failed"
+)
+
+// Job is an entry in the job log. Each change of status is appended as a new entry.
+type Job struct {
+	// Source is the path of the file relative to the inbox.
+	Source        string    `json:"source"`
+	SourceModTime time.Time `json:"source_mod_time"`
+	// Target is the name of the files in the media dir without an extension e.g. peepshow-S01E01
+	Target string    `json:"target,omitempty"`
+	Status JobStatus `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Finished checks if the job should not be retried. Failed jobs are retried if the source file changes.
+func (j Job) Finished(sourceModTime time.Time) bool {
+	return (j.Status == JobStatusDone || j.Status == JobStatusFailed) && j.SourceModTime.Equal(sourceModTime)
+}
+
+// OpenJobLog replays the existing log (if any) so that interrupted jobs can be resumed.
+func OpenJobLog(path string) (*JobLog, error) {
+	l := &JobLog{path: path, jobs: map[string]Job{}}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return l, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		job := Job{}
+		if err := json.Unmarshal(scanner.Bytes(), &job); err != nil {
+			// the last line may be incomplete if the process was killed. The job will just be re-run.
+			continue
+		}
+		l.jobs[job.Source] = job
+	}
+	return l, scanner.Err()
+}
+
+// JobLog is an append-only log of the status of each file that has been ingested.
+type JobLog struct {
+	path string
+	lock sync.Mutex
+	jobs map[string]Job
+}
+
+// Get returns the latest status of the job for the given source.
+func (l *JobLog) Get(source string) (Job, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	job, ok := l.jobs[source]
+	return job, ok
+}
+
+func (l *JobLog) Record(job Job) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	job.Time = time.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open job log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write job log: %w", err)
+	}
+	l.jobs[job.Source] = job
+	return nil
+}
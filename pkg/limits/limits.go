@@ -3,3 +3,9 @@ package limits
 import "time"
 
 const MaxGifDuration = time.Second * 30
+
+// MaxUploadSize is discord's attachment limit for servers without boosts.
+const MaxUploadSize = 1024 * 1024 * 10
+
+// MaxComposedClips is the maximum number of clips (including the original) in a composition.
+const MaxComposedClips = 4
@@ -1,72 +1,239 @@
 package mediacache
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"os"
-	"path"
-	"syscall"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const janitorInterval = time.Minute
+
+type CacheOption func(c *Cache)
+
+// WithMaxSize limits the total size of the cached files. Least recently used files are evicted
+// by the janitor once the limit is exceeded. Zero means unlimited. This should only be used with storage
+// that supports Touch and is not shared with other caches.
+func WithMaxSize(maxBytes int64) CacheOption {
+	return func(c *Cache) {
+		c.maxBytes = maxBytes
+	}
+}
+
+type cacheEntry struct {
+	size       int64
+	lastAccess time.Time
+}
+
+// CacheStats are counters since the cache was created, plus the current size.
+type CacheStats struct {
+	Hits         int64 `json:"hits"`
+	Misses       int64 `json:"misses"`
+	Bypassed     int64 `json:"bypassed"`
+	Evictions    int64 `json:"evictions"`
+	BytesServed  int64 `json:"bytes_served"`
+	BytesWritten int64 `json:"bytes_written"`
+	Entries      int   `json:"entries"`
+	SizeBytes    int64 `json:"size_bytes"`
+	MaxBytes     int64 `json:"max_bytes"`
+}
+
 type Cache struct {
 	logger   *slog.Logger
-	cacheDir string
+	storage  Storage
+	maxBytes int64
+
+	lock    sync.Mutex
+	entries map[string]*cacheEntry
+	size    int64
+
+	hits         atomic.Int64
+	misses       atomic.Int64
+	bypassed     atomic.Int64
+	evictions    atomic.Int64
+	bytesServed  atomic.Int64
+	bytesWritten atomic.Int64
 }
 
-func NewCache(cacheDir string, log *slog.Logger) (*Cache, error) {
-	return &Cache{cacheDir: cacheDir, logger: log.With(slog.String("component", "media_cache"))}, nil
+func NewCache(storage Storage, log *slog.Logger, opts ...CacheOption) (*Cache, error) {
+	c := &Cache{
+		storage: storage,
+		logger:  log.With(slog.String("component", "media_cache")),
+		entries: map[string]*cacheEntry{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if err := c.loadEntries(); err != nil {
+		return nil, fmt.Errorf("failed to index cache: %w", err)
+	}
+	c.evict()
+	return c, nil
+}
+
+// loadEntries indexes the existing files in the storage.
+func (c *Cache) loadEntries() error {
+	files, err := c.storage.List()
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, v := range files {
+		c.entries[v.Key] = &cacheEntry{size: v.Size, lastAccess: v.LastAccess}
+		c.size += v.Size
+	}
+	c.logger.Info("Indexed cache", slog.Int("entries", len(c.entries)), slog.Int64("size", c.size))
+	return nil
 }
 
 func (c *Cache) Get(key string, writeTo io.Writer, noCache bool, fetchFn func(writer io.Writer) error) (bool, error) {
 	if noCache {
+		c.bypassed.Add(1)
 		return false, fetchFn(writeTo)
 	}
-	filePath := path.Join(c.cacheDir, key)
-	f, err := os.Open(filePath)
+	// the file is read into a buffer first so a failed read can't leave partial output in the writer.
+	cached := &bytes.Buffer{}
+	n, err := c.storage.Read(key, cached)
 	if err == nil {
-		defer f.Close()
-		if _, err = io.Copy(writeTo, f); err == nil {
-			return true, nil
+		c.hits.Add(1)
+		c.bytesServed.Add(n)
+		if err := c.storage.Touch(key); err != nil {
+			c.logger.Warn("failed to touch cached file", slog.String("key", key), slog.String("err", err.Error()))
 		}
-		c.logger.Error("failed to write to writer", slog.String("err", err.Error()))
-		return false, fetchFn(writeTo)
+		c.touch(key, n)
+		_, err := io.Copy(writeTo, cached)
+		return true, err
 	}
-	if !errors.Is(err, os.ErrNotExist) {
-		c.logger.Error("failed to open cached file", slog.String("file_path", filePath), slog.String("err", err.Error()))
-		return false, fetchFn(writeTo)
+	if !errors.Is(err, ErrNotFound) {
+		// treat it as a miss so the file will be replaced.
+		c.logger.Error("failed to read cached file", slog.String("key", key), slog.String("err", err.Error()))
 	}
 
-	// cached file doesn't exist
-	cacheFileCreated, err := func() (bool, error) {
-		newFile, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
-		if err != nil {
-			c.logger.Error("failed to create cached file", slog.String("file_path", filePath), slog.String("err", err.Error()))
-			return false, fetchFn(writeTo)
+	// cached file doesn't exist (or couldn't be read)
+	c.misses.Add(1)
+
+	buff := &bytes.Buffer{}
+	if err := fetchFn(io.MultiWriter(writeTo, buff)); err != nil {
+		return false, err
+	}
+	size := int64(buff.Len())
+	if err := c.storage.Write(key, buff, size); err != nil {
+		// the output was still written successfully so this is not returned.
+		c.logger.Error("failed to write cached file", slog.String("key", key), slog.String("err", err.Error()))
+		return false, nil
+	}
+	c.bytesWritten.Add(size)
+	c.touch(key, size)
+	return false, nil
+}
+
+// touch records an access to the key.
+func (c *Cache) touch(key string, size int64) {
+	now := time.Now()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if entry, ok := c.entries[key]; ok {
+		c.size += size - entry.size
+		entry.size = size
+		entry.lastAccess = now
+		return
+	}
+	c.entries[key] = &cacheEntry{size: size, lastAccess: now}
+	c.size += size
+}
+
+// Run starts the janitor which evicts files over the size limit.
+func (c *Cache) Run(ctx context.Context) {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.evict()
 		}
-		defer func() {
-			if err := newFile.Close(); err != nil {
-				panic(fmt.Sprintf("failed to close file after write: %s", err.Error()))
-			}
-		}()
-		if err = syscall.Flock(int(newFile.Fd()), syscall.LOCK_EX); err != nil {
-			c.logger.Error("failed to lock file for writing", slog.String("file_path", filePath), slog.String("err", err.Error()))
-			return true, fetchFn(writeTo)
+	}
+}
+
+// evict removes the least recently used files until the cache is within its size limit.
+func (c *Cache) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+	evicted := c.selectEvictions()
+
+	// deletes may be slow (e.g. S3) so the lock is not held while they're made.
+	for key, entry := range evicted {
+		if err := c.storage.Delete(key); err != nil {
+			c.logger.Error("failed to evict file", slog.String("key", key), slog.String("err", err.Error()))
+			c.restore(key, entry)
+			continue
 		}
-		defer func() {
-			if err := syscall.Flock(int(newFile.Fd()), syscall.LOCK_UN); err != nil {
-				panic(fmt.Sprintf("failed to unlock file after write: %s", err.Error()))
-			}
-		}()
-		return true, fetchFn(io.MultiWriter(writeTo, newFile))
-	}()
-	if err != nil {
-		if cacheFileCreated {
-			if err := os.Remove(filePath); err != nil {
-				c.logger.Error("failed to remove cached file after write error.", slog.String("file_path", filePath), slog.String("err", err.Error()))
-			}
+		c.evictions.Add(1)
+	}
+}
+
+// selectEvictions removes the least recently used entries until the cache is within its size limit and returns them.
+func (c *Cache) selectEvictions() map[string]*cacheEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	evicted := map[string]*cacheEntry{}
+	if c.size <= c.maxBytes {
+		return evicted
+	}
+	keys := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return c.entries[a].lastAccess.Compare(c.entries[b].lastAccess)
+	})
+	for _, key := range keys {
+		if c.size <= c.maxBytes {
+			break
 		}
+		evicted[key] = c.entries[key]
+		c.size -= c.entries[key].size
+		delete(c.entries, key)
+	}
+	return evicted
+}
+
+// restore re-adds an entry that could not be evicted, unless it was accessed again in the meantime.
+func (c *Cache) restore(key string, entry *cacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.entries[key] = entry
+	c.size += entry.size
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.lock.Lock()
+	entries, size := len(c.entries), c.size
+	c.lock.Unlock()
+
+	return CacheStats{
+		Hits:         c.hits.Load(),
+		Misses:       c.misses.Load(),
+		Bypassed:     c.bypassed.Load(),
+		Evictions:    c.evictions.Load(),
+		BytesServed:  c.bytesServed.Load(),
+		BytesWritten: c.bytesWritten.Load(),
+		Entries:      entries,
+		SizeBytes:    size,
+		MaxBytes:     c.maxBytes,
 	}
-	return false, err
 }
@@ -0,0 +1,136 @@
+package mediacache
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeString(s string) func(writer io.Writer) error {
+	return func(writer io.Writer) error {
+		_, err := io.WriteString(writer, s)
+		return err
+	}
+}
+
+func newTestStorage(t *testing.T, dir string) *FilesystemStorage {
+	storage, err := NewFilesystemStorage(dir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	return storage
+}
+
+func TestCache_Get(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewCache(newTestStorage(t, dir), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	hit, err := cache.Get("foo.webp", out, false, writeString("foo"))
+	require.NoError(t, err)
+	require.False(t, hit)
+	require.Equal(t, "foo", out.String())
+
+	out.Reset()
+	hit, err = cache.Get("foo.webp", out, false, func(writer io.Writer) error {
+		t.Fatal("fetch should not be called on a cache hit")
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, hit)
+	require.Equal(t, "foo", out.String())
+
+	// failed writes must not leave anything in the cache dir.
+	_, err = cache.Get("bar.webp", &bytes.Buffer{}, false, func(writer io.Writer) error {
+		_, _ = io.WriteString(writer, "partial")
+		return errors.New("render failed")
+	})
+	require.Error(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "foo.webp", entries[0].Name())
+
+	_, err = cache.Get("foo.webp", &bytes.Buffer{}, true, writeString("foo"))
+	require.NoError(t, err)
+
+	require.Equal(t, CacheStats{
+		Hits:         1,
+		Misses:       2,
+		Bypassed:     1,
+		BytesServed:  3,
+		BytesWritten: 3,
+		Entries:      1,
+		SizeBytes:    3,
+	}, cache.Stats())
+}
+
+func TestCache_Evict(t *testing.T) {
+	dir := t.TempDir()
+
+	// existing files should be indexed using their modtime as the last access.
+	now := time.Now()
+	for k, name := range []string{"oldest", "old", "new"} {
+		require.NoError(t, os.WriteFile(path.Join(dir, name), []byte(strings.Repeat("x", 10)), 0644))
+		modTime := now.Add(-time.Hour * time.Duration(10-k))
+		require.NoError(t, os.Chtimes(path.Join(dir, name), modTime, modTime))
+	}
+	// temp files are never indexed.
+	require.NoError(t, os.WriteFile(path.Join(dir, tempFilePrefix+"abc"), []byte("x"), 0644))
+
+	cache, err := NewCache(newTestStorage(t, dir), slog.New(slog.NewTextHandler(io.Discard, nil)), WithMaxSize(25))
+	require.NoError(t, err)
+	require.Equal(t, int64(20), cache.Stats().SizeBytes)
+	require.Equal(t, int64(1), cache.Stats().Evictions)
+
+	_, err = os.Stat(path.Join(dir, "oldest"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// accessing "old" makes "new" the least recently used.
+	_, err = cache.Get("old", &bytes.Buffer{}, false, writeString(""))
+	require.NoError(t, err)
+	_, err = cache.Get("newest", &bytes.Buffer{}, false, writeString(strings.Repeat("x", 10)))
+	require.NoError(t, err)
+
+	cache.evict()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, v := range entries {
+		names = append(names, v.Name())
+	}
+	require.ElementsMatch(t, []string{tempFilePrefix + "abc", "old", "newest"}, names)
+	require.Equal(t, int64(20), cache.Stats().SizeBytes)
+}
+
+// brokenStorage fails part way through every read.
+type brokenStorage struct {
+	*FilesystemStorage
+}
+
+func (s *brokenStorage) Read(key string, writer io.Writer) (int64, error) {
+	n, _ := io.WriteString(writer, "partial")
+	return int64(n), errors.New("connection reset")
+}
+
+func TestCache_GetFailedRead(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "foo.webp"), []byte("foo"), 0644))
+
+	cache, err := NewCache(&brokenStorage{newTestStorage(t, dir)}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	// the partial read must not be included in the output.
+	out := &bytes.Buffer{}
+	hit, err := cache.Get("foo.webp", out, false, writeString("foo"))
+	require.NoError(t, err)
+	require.False(t, hit)
+	require.Equal(t, "foo", out.String())
+}
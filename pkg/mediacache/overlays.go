@@ -1,54 +1,382 @@
 package mediacache
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	_ "image/png"
 	"log/slog"
 	"math/rand/v2"
 	"os"
+	"os/exec"
 	"path"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
+// supportedOverlayExtensions are the image types that can be used as overlays. PNG and WebP may be static or animated.
+var supportedOverlayExtensions = []string{".gif", ".png", ".apng", ".webp"}
+
+// overlayManifestName is a JSON file in the overlay dir containing tags/categories for each overlay.
+const overlayManifestName = "manifest.json"
+
+// maxOverlayDimension is the largest width/height of an uploaded overlay.
+const maxOverlayDimension = 1024
+
+var ErrOverlayExists = errors.New("overlay already exists")
+
 func NewOverlayCache(overlayDir string, logger *slog.Logger) (*OverlayCache, error) {
-	entries, err := os.ReadDir(overlayDir)
+	cache := &OverlayCache{overlayDir: overlayDir, logger: logger, overlays: make([]Overlay, 0)}
+	if err := cache.Reload(); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+type Overlay struct {
+	Name     string
+	Width    int
+	Height   int
+	Animated bool
+	Category string
+	Tags     []string
+	// Hash identifies the file's content so renders can be invalidated if the file is replaced.
+	Hash string
+}
+
+type OverlayManifestEntry struct {
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+type OverlayCache struct {
+	overlayDir string
+	logger     *slog.Logger
+	lock       sync.RWMutex
+	overlays   []Overlay
+}
+
+// Reload re-scans the overlay dir and manifest.
+func (o *OverlayCache) Reload() error {
+	overlays, err := o.scan()
+	if err != nil {
+		return err
+	}
+	o.lock.Lock()
+	o.overlays = overlays
+	o.lock.Unlock()
+
+	o.logger.Info("loaded overlays", slog.Int("total", len(overlays)))
+	return nil
+}
+
+// scan reads all the overlays in the overlay dir along with their metadata from the manifest.
+func (o *OverlayCache) scan() ([]Overlay, error) {
+	entries, err := os.ReadDir(o.overlayDir)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := o.readManifest()
 	if err != nil {
 		return nil, err
 	}
-	cache := &OverlayCache{overlays: make([]string, 0)}
+	overlays := make([]Overlay, 0)
 	for _, v := range entries {
-		if v.IsDir() || !strings.HasSuffix(v.Name(), ".gif") {
+		if v.IsDir() || !isSupportedOverlay(v.Name()) {
+			continue
+		}
+		overlay, err := inspectOverlay(path.Join(o.overlayDir, v.Name()))
+		if err != nil {
+			o.logger.Error("failed to inspect overlay", slog.String("name", v.Name()), slog.String("err", err.Error()))
 			continue
 		}
-		cache.overlays = append(cache.overlays, path.Base(v.Name()))
-		logger.Info("discovered overlay", slog.String("name", path.Base(v.Name())))
+		if meta, ok := manifest[overlay.Name]; ok {
+			overlay.Category = meta.Category
+			overlay.Tags = meta.Tags
+		}
+		overlays = append(overlays, overlay)
+		o.logger.Debug(
+			"discovered overlay",
+			slog.String("name", overlay.Name),
+			slog.Int("width", overlay.Width),
+			slog.Int("height", overlay.Height),
+			slog.Bool("animated", overlay.Animated),
+		)
 	}
-	return cache, nil
+	return overlays, nil
 }
 
-type OverlayCache struct {
-	overlays []string
+// Watch reloads the cache whenever the overlay dir changes.
+func (o *OverlayCache) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(o.overlayDir); err != nil {
+		return err
+	}
+
+	// files may be copied in batches so wait for changes to settle before reloading.
+	ticker := time.NewTicker(time.Second * 2)
+	defer ticker.Stop()
+
+	changed := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if path.Base(event.Name) == overlayManifestName || isSupportedOverlay(event.Name) {
+				changed = true
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			o.logger.Error("overlay watcher error", slog.String("err", err.Error()))
+		case <-ticker.C:
+			if changed {
+				if err := o.Reload(); err != nil {
+					o.logger.Error("failed to reload overlays", slog.String("err", err.Error()))
+				}
+				changed = false
+			}
+		}
+	}
 }
 
 func (o *OverlayCache) Random(num int) []string {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
 	random := []string{}
 	for i := 0; i < num; i++ {
-		random = append(random, o.overlays[rand.IntN(len(o.overlays)-1)])
+		random = append(random, o.overlays[rand.IntN(len(o.overlays)-1)].Name)
 	}
 	return random
 }
 
-func (o *OverlayCache) All() []string {
-	all := []string{}
+func (o *OverlayCache) All() []Overlay {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	all := []Overlay{}
 	for _, val := range o.overlays {
 		all = append(all, val)
 	}
 	return all
 }
 
-func (o *OverlayCache) Exists(name string) bool {
+// Search returns overlays where the name contains the term or the term matches a tag or category.
+func (o *OverlayCache) Search(term string) []Overlay {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	term = strings.ToLower(strings.TrimSpace(term))
+	found := []Overlay{}
 	for _, val := range o.overlays {
-		if name == val {
+		if term == "" ||
+			strings.Contains(strings.ToLower(val.Name), term) ||
+			strings.ToLower(val.Category) == term ||
+			slices.ContainsFunc(val.Tags, func(tag string) bool { return strings.ToLower(tag) == term }) {
+			found = append(found, val)
+		}
+	}
+	return found
+}
+
+func (o *OverlayCache) Get(name string) (Overlay, bool) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	return o.get(name)
+}
+
+// get must be called with the lock held.
+func (o *OverlayCache) get(name string) (Overlay, bool) {
+	for _, val := range o.overlays {
+		if name == val.Name {
+			return val, true
+		}
+	}
+	return Overlay{}, false
+}
+
+func (o *OverlayCache) Exists(name string) bool {
+	_, ok := o.Get(name)
+	return ok
+}
+
+// Add validates and stores a new overlay in the library. The lock is held for the whole add so two overlays with
+// the same name cannot be added at once.
+func (o *OverlayCache) Add(name string, data []byte, meta OverlayManifestEntry) (Overlay, error) {
+	name = path.Base(name)
+	if !isSupportedOverlay(name) {
+		return Overlay{}, fmt.Errorf("unsupported file type, expected one of: %s", strings.Join(supportedOverlayExtensions, ", "))
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	finalPath := path.Join(o.overlayDir, name)
+	if _, ok := o.get(name); ok {
+		return Overlay{}, ErrOverlayExists
+	}
+	if _, err := os.Stat(finalPath); err == nil {
+		// the file may exist but not have been loaded yet.
+		return Overlay{}, ErrOverlayExists
+	}
+
+	// write to a temp file first so a partial/invalid file is never picked up by a reload.
+	tmpPath := path.Join(o.overlayDir, name+".tmp")
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return Overlay{}, fmt.Errorf("failed to write file: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	if err := probeOverlay(tmpPath); err != nil {
+		return Overlay{}, err
+	}
+	overlay, err := inspectOverlay(tmpPath)
+	if err != nil {
+		return Overlay{}, err
+	}
+	if overlay.Width > maxOverlayDimension || overlay.Height > maxOverlayDimension {
+		return Overlay{}, fmt.Errorf("overlay is too large (max %dx%d)", maxOverlayDimension, maxOverlayDimension)
+	}
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return Overlay{}, fmt.Errorf("failed to move overlay into place: %w", err)
+	}
+	if len(meta.Tags) > 0 || meta.Category != "" {
+		if err := o.updateManifest(name, meta); err != nil {
+			// remove the overlay so it can be uploaded again with its tags.
+			if rmErr := os.Remove(finalPath); rmErr != nil {
+				o.logger.Error("failed to remove overlay", slog.String("name", name), slog.String("err", rmErr.Error()))
+			}
+			return Overlay{}, err
+		}
+	}
+	overlays, err := o.scan()
+	if err != nil {
+		return Overlay{}, err
+	}
+	o.overlays = overlays
+	overlay, _ = o.get(name)
+	return overlay, nil
+}
+
+func (o *OverlayCache) readManifest() (map[string]OverlayManifestEntry, error) {
+	manifest := map[string]OverlayManifestEntry{}
+	f, err := os.Open(path.Join(o.overlayDir, overlayManifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode overlay manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// updateManifest must be called with the lock held.
+func (o *OverlayCache) updateManifest(name string, meta OverlayManifestEntry) error {
+	manifest, err := o.readManifest()
+	if err != nil {
+		return err
+	}
+	manifest[name] = meta
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(o.overlayDir, overlayManifestName), data, 0644)
+}
+
+func isSupportedOverlay(name string) bool {
+	for _, ext := range supportedOverlayExtensions {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
 			return true
 		}
 	}
 	return false
 }
+
+func inspectOverlay(filePath string) (Overlay, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return Overlay{}, err
+	}
+	conf, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Overlay{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+	hash := sha256.Sum256(data)
+	return Overlay{
+		Name:     path.Base(filePath),
+		Width:    conf.Width,
+		Height:   conf.Height,
+		Animated: isAnimated(format, data),
+		Hash:     hex.EncodeToString(hash[:12]),
+	}, nil
+}
+
+// probeOverlay checks ffmpeg can actually read the file since the image package only checks the headers.
+func probeOverlay(filePath string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	out := &bytes.Buffer{}
+	cmd := exec.CommandContext(
+		ctx,
+		"ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=codec_type",
+		"-of", "csv=p=0",
+		filePath,
+	)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffprobe failed: %w: %s", err, strings.TrimSpace(out.String()))
+	}
+	if strings.TrimSpace(out.String()) != "video" {
+		return fmt.Errorf("file did not contain a valid image stream")
+	}
+	return nil
+}
+
+// isAnimated checks the image headers for animation. GIFs are always treated as animated.
+func isAnimated(format string, data []byte) bool {
+	switch format {
+	case "png":
+		// APNG files have an acTL chunk before the first image data.
+		idat := bytes.Index(data, []byte("IDAT"))
+		actl := bytes.Index(data, []byte("acTL"))
+		return actl != -1 && (idat == -1 || actl < idat)
+	case "webp":
+		// RIFF header (12 bytes) followed by a VP8X chunk header (8 bytes) then the flags.
+		return len(data) > 20 && string(data[12:16]) == "VP8X" && data[20]&(1<<1) != 0
+	default:
+		return true
+	}
+}
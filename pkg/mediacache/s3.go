@@ -0,0 +1,128 @@
+package mediacache
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/spf13/pflag"
+	"github.com/warmans/tvgif/pkg/flag"
+	"io"
+	"strings"
+	"time"
+)
+
+const s3RequestTimeout = time.Second * 30
+
+type S3Config struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// Prefix is prepended to all keys so a bucket can be shared.
+	Prefix   string
+	Insecure bool
+}
+
+func (c *S3Config) RegisterFlags(fs *pflag.FlagSet, prefix string) {
+	flag.StringVarEnv(fs, &c.Endpoint, prefix, "cache-s3-endpoint", "", "store cached files in an S3 compatible bucket at this endpoint e.g. s3.amazonaws.com or minio:9000")
+	flag.StringVarEnv(fs, &c.Bucket, prefix, "cache-s3-bucket", "", "S3 bucket name")
+	flag.StringVarEnv(fs, &c.Region, prefix, "cache-s3-region", "us-east-1", "S3 region")
+	flag.StringVarEnv(fs, &c.AccessKey, prefix, "cache-s3-access-key", "", "S3 access key")
+	flag.StringVarEnv(fs, &c.SecretKey, prefix, "cache-s3-secret-key", "", "S3 secret key")
+	flag.StringVarEnv(fs, &c.Prefix, prefix, "cache-s3-prefix", "", "prefix for all cached objects e.g. cache/")
+	flag.BoolVarEnv(fs, &c.Insecure, prefix, "cache-s3-insecure", false, "use HTTP instead of HTTPS")
+}
+
+func (c *S3Config) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+	return &S3Storage{client: client, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+// S3Storage keeps files in an S3 compatible bucket so they can be shared between multiple bots.
+// Objects are immutable so accesses can't be recorded and the last modified time is used as the last access
+// time. Since each bot also only knows about its own accesses, it should not be used with a cache size limit.
+// Instead use a lifecycle rule on the bucket to expire old objects.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func (s *S3Storage) Read(key string, writer io.Writer) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	obj, err := s.client.GetObject(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return 0, s.wrapError(err)
+	}
+	defer obj.Close()
+
+	// the request is not actually made until the object is read, so errors must also be checked here.
+	n, err := io.Copy(writer, obj)
+	if err != nil {
+		return n, s.wrapError(err)
+	}
+	return n, nil
+}
+
+func (s *S3Storage) Write(key string, data io.Reader, size int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, data, size, minio.PutObjectOptions{})
+	return s.wrapError(err)
+}
+
+func (s *S3Storage) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	return s.wrapError(s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{}))
+}
+
+func (s *S3Storage) List() ([]StoredFile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	files := []StoredFile{}
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, s.wrapError(obj.Err)
+		}
+		files = append(files, StoredFile{
+			Key:        strings.TrimPrefix(obj.Key, s.prefix),
+			Size:       obj.Size,
+			LastAccess: obj.LastModified,
+		})
+	}
+	return files, nil
+}
+
+// Touch is a no-op since updating the object's time would require copying it.
+func (s *S3Storage) Touch(key string) error {
+	return nil
+}
+
+func (s *S3Storage) wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
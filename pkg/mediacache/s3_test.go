@@ -0,0 +1,164 @@
+package mediacache
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 implements enough of the S3 API for the S3Storage.
+type fakeS3 struct {
+	lock    sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		f.writeError(resp, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	switch {
+	case req.Method == http.MethodGet && key == "":
+		f.list(resp, req.URL.Query())
+	case req.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			f.writeError(resp, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		resp.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		_, _ = resp.Write(data)
+	case req.Method == http.MethodPut:
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			f.writeError(resp, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		if strings.HasPrefix(req.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data = decodeAWSChunked(data)
+		}
+		f.objects[key] = data
+		resp.Header().Set("ETag", `"etag"`)
+	case req.Method == http.MethodDelete:
+		delete(f.objects, key)
+		resp.WriteHeader(http.StatusNoContent)
+	default:
+		f.writeError(resp, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// decodeAWSChunked strips the chunk headers used by signed streaming uploads e.g. 3;chunk-signature=abc\r\nfoo\r\n
+func decodeAWSChunked(body []byte) []byte {
+	out := []byte{}
+	for len(body) > 0 {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			break
+		}
+		sizeHex, _, _ := strings.Cut(string(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil || size == 0 || int64(len(rest)) < size {
+			break
+		}
+		out = append(out, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+	return out
+}
+
+func (f *fakeS3) list(resp http.ResponseWriter, query url.Values) {
+	type content struct {
+		Key          string
+		Size         int64
+		LastModified string
+	}
+	result := struct {
+		XMLName  xml.Name `xml:"ListBucketResult"`
+		Name     string
+		Prefix   string
+		KeyCount int
+		Contents []content
+	}{Name: f.bucket, Prefix: query.Get("prefix")}
+
+	keys := []string{}
+	for k := range f.objects {
+		if strings.HasPrefix(k, result.Prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		result.Contents = append(result.Contents, content{
+			Key:          k,
+			Size:         int64(len(f.objects[k])),
+			LastModified: time.Now().UTC().Format(time.RFC3339),
+		})
+	}
+	result.KeyCount = len(result.Contents)
+
+	resp.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(resp).Encode(result)
+}
+
+func (f *fakeS3) writeError(resp http.ResponseWriter, status int, code string) {
+	resp.Header().Set("Content-Type", "application/xml")
+	resp.WriteHeader(status)
+	_ = xml.NewEncoder(resp).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+	}{Code: code})
+}
+
+func TestS3Storage(t *testing.T) {
+	fake := &fakeS3{bucket: "tvgif", objects: map[string][]byte{"other/file": []byte("not in prefix")}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	storage, err := NewS3Storage(S3Config{
+		Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+		Bucket:    "tvgif",
+		Region:    "us-east-1",
+		AccessKey: "key",
+		SecretKey: "secret",
+		Prefix:    "cache/",
+		Insecure:  true,
+	})
+	require.NoError(t, err)
+
+	_, err = storage.Read("foo.webp", &bytes.Buffer{})
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, storage.Write("foo.webp", strings.NewReader("foo"), 3))
+	require.Equal(t, []byte("foo"), fake.objects["cache/foo.webp"])
+
+	out := &bytes.Buffer{}
+	n, err := storage.Read("foo.webp", out)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, n)
+	require.Equal(t, "foo", out.String())
+
+	files, err := storage.List()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, "foo.webp", files[0].Key)
+	require.EqualValues(t, 3, files[0].Size)
+
+	require.NoError(t, storage.Delete("foo.webp"))
+	_, err = storage.Read("foo.webp", &bytes.Buffer{})
+	require.ErrorIs(t, err, ErrNotFound)
+}
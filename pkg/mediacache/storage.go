@@ -0,0 +1,140 @@
+package mediacache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// tempFilePrefix is used for files that are still being written. They are renamed to the final key once complete
+// so a partially written file can never be served.
+const tempFilePrefix = ".tmp-"
+
+// staleTempFileAge is how old a temp file must be before it is assumed to have been abandoned.
+const staleTempFileAge = time.Hour
+
+var ErrNotFound = errors.New("not found")
+
+// StoredFile describes a file in the cache storage.
+type StoredFile struct {
+	Key        string
+	Size       int64
+	LastAccess time.Time
+}
+
+// Storage is where cached files are kept. Writes must be atomic: a file is either fully written or not visible at all.
+type Storage interface {
+	// Read copies the file to the writer. ErrNotFound is returned if the key does not exist.
+	Read(key string, writer io.Writer) (int64, error)
+	Write(key string, data io.Reader, size int64) error
+	Delete(key string) error
+	List() ([]StoredFile, error)
+	// Touch records an access so the last access time is retained between restarts. It may be a no-op if
+	// the storage has no cheap way to update the time.
+	Touch(key string) error
+}
+
+func NewFilesystemStorage(dir string, logger *slog.Logger) (*FilesystemStorage, error) {
+	s := &FilesystemStorage{dir: dir, logger: logger}
+	if err := s.removeStaleTempFiles(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// FilesystemStorage keeps files in a local directory. Modification times are used as the last access time.
+type FilesystemStorage struct {
+	dir    string
+	logger *slog.Logger
+}
+
+func (s *FilesystemStorage) Read(key string, writer io.Writer) (int64, error) {
+	f, err := os.Open(path.Join(s.dir, key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(writer, f)
+}
+
+func (s *FilesystemStorage) Write(key string, data io.Reader, size int64) error {
+	tmpFile, err := os.CreateTemp(s.dir, tempFilePrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		// if the file was renamed this will fail but that's fine.
+		_ = os.Remove(tmpFile.Name())
+	}()
+	if _, err := io.Copy(tmpFile, data); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), path.Join(s.dir, key)); err != nil {
+		return fmt.Errorf("failed to move temp file into place: %w", err)
+	}
+	return nil
+}
+
+func (s *FilesystemStorage) Delete(key string) error {
+	if err := os.Remove(path.Join(s.dir, key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FilesystemStorage) List() ([]StoredFile, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []StoredFile{}
+	for _, v := range dirEntries {
+		if v.IsDir() || strings.HasPrefix(v.Name(), tempFilePrefix) {
+			continue
+		}
+		info, err := v.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, StoredFile{Key: v.Name(), Size: info.Size(), LastAccess: info.ModTime()})
+	}
+	return files, nil
+}
+
+func (s *FilesystemStorage) Touch(key string) error {
+	now := time.Now()
+	return os.Chtimes(path.Join(s.dir, key), now, now)
+}
+
+// removeStaleTempFiles cleans up any files that were being written when the process last exited.
+func (s *FilesystemStorage) removeStaleTempFiles() error {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, v := range dirEntries {
+		if !strings.HasPrefix(v.Name(), tempFilePrefix) {
+			continue
+		}
+		info, err := v.Info()
+		if err != nil || time.Since(info.ModTime()) < staleTempFileAge {
+			continue
+		}
+		if err := os.Remove(path.Join(s.dir, v.Name())); err != nil {
+			s.logger.Error("failed to remove stale temp file", slog.String("name", v.Name()), slog.String("err", err.Error()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/warmans/tvgif/pkg/util"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+)
+
+// namingConfigFile can be placed in the media dir (or the var dir) to override the file name patterns.
+const namingConfigFile = "naming.json"
+
+// defaultFilePatterns are checked in order. Publications may contain hyphens, multi-part episodes are
+// named like S01E01E02 (or S01E01-E02) and files with no series/episode are films.
+var defaultFilePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?P<publication>[a-zA-Z0-9-]+?)-[sS](?P<series>\d+)[eE](?P<episode>\d+)(?:-?[eE](?P<last_episode>\d+))?\.srt$`),
+	regexp.MustCompile(`^(?P<publication>[a-zA-Z0-9-]+)\.srt$`),
+}
+
+// episodeTokenRegex finds a series/episode token anywhere in a file name e.g. peepshow-S01E01-extra.srt
+var episodeTokenRegex = regexp.MustCompile(`(?i)\bS\d+E\d+`)
+
+// NamingConfig allows custom file name patterns. Patterns must name a publication group and optionally
+// series, episode and last_episode groups e.g. ^(?P<publication>\w+)\.(?P<series>\d+)x(?P<episode>\d+)\.srt$
+type NamingConfig struct {
+	Patterns []string `json:"patterns"`
+}
+
+type parsedFileName struct {
+	publication string
+	series      int32
+	episode     int32
+	lastEpisode int32
+}
+
+// readFilePatterns uses the naming config in the SRT's dir, falling back to the var dir and then the defaults.
+func readFilePatterns(srtDir string, varDir string) ([]*regexp.Regexp, error) {
+	for _, dir := range []string{srtDir, varDir} {
+		data, err := os.ReadFile(path.Join(dir, namingConfigFile))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", namingConfigFile, err)
+		}
+		cfg := NamingConfig{}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path.Join(dir, namingConfigFile), err)
+		}
+		patterns := make([]*regexp.Regexp, len(cfg.Patterns))
+		for k, v := range cfg.Patterns {
+			if patterns[k], err = regexp.Compile(v); err != nil {
+				return nil, fmt.Errorf("invalid pattern in %s: %w", path.Join(dir, namingConfigFile), err)
+			}
+			if patterns[k].SubexpIndex("publication") == -1 {
+				return nil, fmt.Errorf("pattern in %s has no publication group: %s", path.Join(dir, namingConfigFile), v)
+			}
+		}
+		return patterns, nil
+	}
+	return defaultFilePatterns, nil
+}
+
+// parseAnyFileName uses the first pattern that matches the file name.
+func parseAnyFileName(patterns []*regexp.Regexp, filename string) (parsedFileName, error) {
+	for _, re := range patterns {
+		if re.MatchString(filename) {
+			return parseFileName(re, filename)
+		}
+	}
+	return parsedFileName{}, fmt.Errorf("no file pattern matched %s", filename)
+}
+
+func parseFileName(filePatternRegex *regexp.Regexp, filename string) (parsedFileName, error) {
+
+	match := filePatternRegex.FindStringSubmatch(filename)
+	if match == nil {
+		return parsedFileName{}, fmt.Errorf("failed to match file name %s", filename)
+	}
+	result := make(map[string]string)
+	for i, name := range filePatternRegex.SubexpNames() {
+		if i != 0 && name != "" {
+			result[name] = match[i]
+		}
+	}
+
+	parsed := parsedFileName{publication: result["publication"]}
+	if parsed.publication == "" {
+		return parsedFileName{}, fmt.Errorf("file pattern did not match publication in: %s", filename)
+	}
+
+	var err error
+	if parsed.series, err = parseNumericGroup(result, "series"); err != nil {
+		return parsedFileName{}, err
+	}
+	if parsed.episode, err = parseNumericGroup(result, "episode"); err != nil {
+		return parsedFileName{}, err
+	}
+	if parsed.lastEpisode, err = parseNumericGroup(result, "last_episode"); err != nil {
+		return parsedFileName{}, err
+	}
+	if (result["series"] == "") != (result["episode"] == "") {
+		return parsedFileName{}, fmt.Errorf("file pattern matched only one of series and episode in: %s", filename)
+	}
+	if result["series"] == "" && episodeTokenRegex.MatchString(filename) {
+		// an episode with an unexpected name should not be imported as a film.
+		return parsedFileName{}, fmt.Errorf("file name contains a series and episode but was matched as a film: %s", filename)
+	}
+	if result["series"] != "" && parsed.series == 0 && parsed.episode == 0 {
+		// S00E00 would be indistinguishable from a film.
+		return parsedFileName{}, fmt.Errorf("S00E00 is not a valid episode: %s", filename)
+	}
+	if parsed.lastEpisode != 0 && parsed.lastEpisode <= parsed.episode {
+		return parsedFileName{}, fmt.Errorf("last episode must be after the first episode in: %s", filename)
+	}
+	return parsed, nil
+}
+
+// parseNumericGroup parses the named group, missing groups are zero.
+func parseNumericGroup(result map[string]string, name string) (int32, error) {
+	raw := result[name]
+	if raw == "" {
+		return 0, nil
+	}
+	val, err := strconv.ParseInt(util.NormaliseNumericIdentifier(raw), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse matched %s int %s: %w", name, raw, err)
+	}
+	return int32(val), nil
+}
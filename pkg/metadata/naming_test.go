@@ -0,0 +1,60 @@
+package metadata
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestParseAnyFileName(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     parsedFileName
+		wantErr  bool
+	}{
+		{filename: "peepshow-S01E02.srt", want: parsedFileName{publication: "peepshow", series: 1, episode: 2}},
+		{filename: "the-thick-of-it-S03E04.srt", want: parsedFileName{publication: "the-thick-of-it", series: 3, episode: 4}},
+		{filename: "peepshow-S00E01.srt", want: parsedFileName{publication: "peepshow", series: 0, episode: 1}},
+		{filename: "peepshow-S01E01E02.srt", want: parsedFileName{publication: "peepshow", series: 1, episode: 1, lastEpisode: 2}},
+		{filename: "peepshow-S01E01-E02.srt", want: parsedFileName{publication: "peepshow", series: 1, episode: 1, lastEpisode: 2}},
+		{filename: "the-italian-job.srt", want: parsedFileName{publication: "the-italian-job"}},
+		{filename: "peepshow-S00E00.srt", wantErr: true},
+		{filename: "peepshow-S01E01-extra.srt", wantErr: true},
+		{filename: "peepshow-s01e01x.srt", wantErr: true},
+		{filename: "peepshow-S01E02E01.srt", wantErr: true},
+		{filename: "peep show.srt", wantErr: true},
+		{filename: "peepshow-S01E01.webm", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, err := parseAnyFileName(defaultFilePatterns, tt.filename)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReadFilePatterns(t *testing.T) {
+	srtDir, varDir := t.TempDir(), t.TempDir()
+
+	patterns, err := readFilePatterns(srtDir, varDir)
+	require.NoError(t, err)
+	require.Equal(t, defaultFilePatterns, patterns)
+
+	require.NoError(t, os.WriteFile(path.Join(varDir, namingConfigFile), []byte(`{"patterns": ["^(?P<publication>\\w+)\\.(?P<series>\\d+)x(?P<episode>\\d+)\\.srt$"]}`), 0644))
+	patterns, err = readFilePatterns(srtDir, varDir)
+	require.NoError(t, err)
+	parsed, err := parseAnyFileName(patterns, "simpsons.10x01.srt")
+	require.NoError(t, err)
+	require.Equal(t, parsedFileName{publication: "simpsons", series: 10, episode: 1}, parsed)
+
+	// config in the SRT's dir takes precedence
+	require.NoError(t, os.WriteFile(path.Join(srtDir, namingConfigFile), []byte(`{"patterns": ["^(?P<series>\\d+)\\.srt$"]}`), 0644))
+	_, err = readFilePatterns(srtDir, varDir)
+	require.Error(t, err, "patterns must have a publication group")
+}
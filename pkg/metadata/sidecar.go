@@ -0,0 +1,106 @@
+package metadata
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// sidecar is optional information about an episode stored next to the media with the same name as the SRT.
+type sidecar struct {
+	Title    string `json:"title"`
+	ShowName string `json:"show"`
+	// AirDate e.g. 2003-09-19
+	AirDate string `json:"air_date"`
+}
+
+// nfo is the subset of a Kodi style episodedetails or movie NFO file that is used.
+type nfo struct {
+	Title     string `xml:"title"`
+	ShowTitle string `xml:"showtitle"`
+	Aired     string `xml:"aired"`
+	Premiered string `xml:"premiered"`
+}
+
+// sidecarExtensions are the extensions of sidecar files in the order they are checked.
+var sidecarExtensions = []string{".nfo", ".info.json"}
+
+// SourceModTime is the latest mod time of the SRT and its sidecar files so that a new or changed sidecar causes the
+// episode to be re-imported. Removing a sidecar is not detected, the SRT must be touched instead.
+func SourceModTime(srtPath string, srtModTime time.Time) time.Time {
+	latest := srtModTime
+	for _, ext := range sidecarExtensions {
+		if stat, err := os.Stat(strings.TrimSuffix(srtPath, ".srt") + ext); err == nil && stat.ModTime().After(latest) {
+			latest = stat.ModTime()
+		}
+	}
+	return latest
+}
+
+// readSidecar checks for a <name>.nfo or <name>.info.json file. If neither exists nil is returned.
+func readSidecar(dir string, baseName string) (*sidecar, error) {
+	nfoPath := path.Join(dir, baseName+sidecarExtensions[0])
+	data, err := os.ReadFile(nfoPath)
+	if err == nil {
+		return parseNFO(data)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", path.Base(nfoPath), err)
+	}
+
+	jsonPath := path.Join(dir, baseName+sidecarExtensions[1])
+	data, err = os.ReadFile(jsonPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path.Base(jsonPath), err)
+	}
+	result := &sidecar{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path.Base(jsonPath), err)
+	}
+	return result, nil
+}
+
+func parseNFO(data []byte) (*sidecar, error) {
+	// only the first element is decoded since NFO files often have a scraper URL appended after the XML.
+	if !strings.HasPrefix(strings.TrimSpace(string(data)), "<") {
+		// the NFO contains only a scraper URL.
+		return nil, nil
+	}
+	raw := nfo{}
+	if err := xml.NewDecoder(strings.NewReader(string(data))).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode NFO: %w", err)
+	}
+	airDate := raw.Aired
+	if airDate == "" {
+		airDate = raw.Premiered
+	}
+	return &sidecar{
+		Title:    strings.TrimSpace(raw.Title),
+		ShowName: strings.TrimSpace(raw.ShowTitle),
+		AirDate:  strings.TrimSpace(airDate),
+	}, nil
+}
+
+func (s *sidecar) parseAirDate() (*time.Time, error) {
+	if s.AirDate == "" {
+		return nil, nil
+	}
+	// only the date is used if a time is also given e.g. 2003-09-19 21:00:00 or 2003-09-19T21:00:00Z
+	raw := s.AirDate
+	if len(raw) > len(time.DateOnly) && (raw[len(time.DateOnly)] == ' ' || raw[len(time.DateOnly)] == 'T') {
+		raw = raw[:len(time.DateOnly)]
+	}
+	airDate, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid air date %s: %w", s.AirDate, err)
+	}
+	return &airDate, nil
+}
@@ -0,0 +1,102 @@
+package metadata
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestReadSidecar(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		data     string
+		want     *sidecar
+		wantErr  bool
+	}{
+		{
+			name:     "episode nfo",
+			fileName: "peepshow-S01E02.nfo",
+			data: `<?xml version="1.0" encoding="UTF-8" standalone="yes" ?>
+<episodedetails>
+    <title>Jeremy's Van</title>
+    <showtitle>Peep Show</showtitle>
+    <season>1</season>
+    <episode>2</episode>
+    <aired>2003-09-26</aired>
+</episodedetails>
+https://www.thetvdb.com/?tab=episode&id=1`,
+			want: &sidecar{Title: "Jeremy's Van", ShowName: "Peep Show", AirDate: "2003-09-26"},
+		},
+		{
+			name:     "movie nfo",
+			fileName: "peepshow-S01E02.nfo",
+			data:     `<movie><title>The Italian Job</title><premiered>1969-06-02</premiered></movie>`,
+			want:     &sidecar{Title: "The Italian Job", AirDate: "1969-06-02"},
+		},
+		{
+			name:     "nfo with only a URL",
+			fileName: "peepshow-S01E02.nfo",
+			data:     `https://www.thetvdb.com/?tab=episode&id=1`,
+		},
+		{
+			name:     "json",
+			fileName: "peepshow-S01E02.info.json",
+			data:     `{"title": "Jeremy's Van", "show": "Peep Show", "air_date": "2003-09-26"}`,
+			want:     &sidecar{Title: "Jeremy's Van", ShowName: "Peep Show", AirDate: "2003-09-26"},
+		},
+		{
+			name:     "invalid json",
+			fileName: "peepshow-S01E02.info.json",
+			data:     `{"title": `,
+			wantErr:  true,
+		},
+		{
+			name:     "no sidecar",
+			fileName: "peepshow-S01E03.nfo",
+			data:     `<episodedetails><title>Funny Business</title></episodedetails>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(path.Join(dir, tt.fileName), []byte(tt.data), 0644))
+			got, err := readSidecar(dir, "peepshow-S01E02")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSidecarAirDate(t *testing.T) {
+	airDate, err := (&sidecar{AirDate: "2003-09-26"}).parseAirDate()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2003, 9, 26, 0, 0, 0, 0, time.UTC), *airDate)
+
+	airDate, err = (&sidecar{}).parseAirDate()
+	require.NoError(t, err)
+	require.Nil(t, airDate)
+
+	airDate, err = (&sidecar{AirDate: "2003-09-26 21:00:00"}).parseAirDate()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2003, 9, 26, 0, 0, 0, 0, time.UTC), *airDate)
+
+	_, err = (&sidecar{AirDate: "26/09/2003"}).parseAirDate()
+	require.Error(t, err)
+}
+
+func TestSourceModTime(t *testing.T) {
+	dir := t.TempDir()
+	srtPath := path.Join(dir, "peepshow-S01E02.srt")
+	srtModTime := time.Now().Add(-time.Hour)
+	require.Equal(t, srtModTime, SourceModTime(srtPath, srtModTime))
+
+	require.NoError(t, os.WriteFile(path.Join(dir, "peepshow-S01E02.info.json"), []byte(`{}`), 0644))
+	require.True(t, SourceModTime(srtPath, srtModTime).After(srtModTime))
+}
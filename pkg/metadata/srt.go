@@ -7,21 +7,20 @@ import (
 	"github.com/warmans/tvgif/pkg/limits"
 	"github.com/warmans/tvgif/pkg/model"
 	"github.com/warmans/tvgif/pkg/srt"
-	"github.com/warmans/tvgif/pkg/util"
+	"log/slog"
 	"os"
 	"path"
-	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 )
 
-var filePatternRegex = regexp.MustCompile(`(?P<publication>[a-zA-Z0-9]+)-S(?P<series>\d+)E(?P<episode>\d+)\.srt`)
-
-const videoExtension = ".webm"
+// videoExtensions are checked in order to find the video for an SRT. Anything ffmpeg can read will work
+// but webm is preferred as it was previously required.
+var videoExtensions = []string{".webm", ".mp4", ".mkv"}
 
 const publicationAliasFile = "publications_aliases.json"
 
-func CreateMetadataFromSRT(srtPath, metadataDir, varDir string) (*model.Episode, error) {
+func CreateMetadataFromSRT(srtPath, metadataDir, varDir string, logger *slog.Logger) (*model.Episode, error) {
 
 	srtName := path.Base(srtPath)
 
@@ -32,32 +31,83 @@ func CreateMetadataFromSRT(srtPath, metadataDir, varDir string) (*model.Episode,
 
 	meta := &model.Episode{
 		SRTFile:   srtName,
-		VideoFile: fmt.Sprintf("%s.%s", strings.TrimSuffix(path.Base(srtName), ".srt"), strings.TrimPrefix(videoExtension, ".")),
+		VideoFile: findVideoFile(path.Dir(srtPath), strings.TrimSuffix(srtName, ".srt")),
 	}
-	meta.Publication, meta.Series, meta.Episode, err = parseFileName(filePatternRegex, srtName)
+	filePatterns, err := readFilePatterns(path.Dir(srtPath), varDir)
 	if err != nil {
 		return nil, err
 	}
+	parsed, err := parseAnyFileName(filePatterns, srtName)
+	if err != nil {
+		return nil, err
+	}
+	meta.Publication, meta.Series, meta.Episode, meta.LastEpisode = parsed.publication, parsed.series, parsed.episode, parsed.lastEpisode
+
+	// the sidecar is optional so the episode is still imported if it is invalid.
+	info, err := readSidecar(path.Dir(srtPath), strings.TrimSuffix(srtName, ".srt"))
+	if err != nil {
+		logger.Warn("Failed to read sidecar, it will be ignored", slog.String("srt", srtName), slog.String("err", err.Error()))
+	}
+	if info != nil {
+		meta.Title, meta.ShowName = info.Title, info.ShowName
+		if meta.AirDate, err = info.parseAirDate(); err != nil {
+			logger.Warn("Invalid air date in sidecar, it will be ignored", slog.String("srt", srtName), slog.String("err", err.Error()))
+		}
+	}
 
 	// allow a publication to be assigned a group for an aliases file
 	if publicationGroup, ok := publicationMapping[meta.Publication]; ok {
 		meta.PublicationGroup = publicationGroup
 	}
 
-	fileName := fmt.Sprintf("%s.json", meta.ID())
-	metaPath := path.Join(metadataDir, fileName)
-
 	meta.Dialog, err = parseSRT(srtPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process SRT %s: %w", srtName, err)
 	}
 
-	if err := writeMetadata(metaPath, meta); err != nil {
-		return nil, fmt.Errorf("failed to write metadata: %w", err)
+	if err := SaveMetadata(metadataDir, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// SaveMetadata replaces the metadata JSON for the episode e.g. after the dialog has been modified.
+func SaveMetadata(metadataDir string, meta *model.Episode) error {
+	if err := writeMetadata(path.Join(metadataDir, fmt.Sprintf("%s.json", meta.ID())), meta); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// LoadMetadata reads the metadata JSON for the episode.
+func LoadMetadata(metadataDir string, episodeID string) (*model.Episode, error) {
+	data, err := os.ReadFile(path.Join(metadataDir, fmt.Sprintf("%s.json", episodeID)))
+	if err != nil {
+		return nil, err
+	}
+	meta := &model.Episode{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata for %s: %w", episodeID, err)
 	}
 	return meta, nil
 }
 
+// IsVideoFile checks if the file has one of the supported video extensions.
+func IsVideoFile(name string) bool {
+	return slices.Contains(videoExtensions, path.Ext(name))
+}
+
+// findVideoFile gets the name of the video in the dir with the same name as the SRT.
+func findVideoFile(dir string, baseName string) string {
+	for _, ext := range videoExtensions {
+		if _, err := os.Stat(path.Join(dir, baseName+ext)); err == nil {
+			return baseName + ext
+		}
+	}
+	// the video may not have been added yet.
+	return baseName + videoExtensions[0]
+}
+
 func readPublicationMapping(metadataDir string) (map[string]string, error) {
 	data, err := os.ReadFile(path.Join(metadataDir, publicationAliasFile))
 	if err != nil {
@@ -84,45 +134,6 @@ func writeMetadata(path string, e *model.Episode) error {
 	return enc.Encode(e)
 }
 
-func parseFileName(filePatternRegex *regexp.Regexp, filename string) (string, int32, int32, error) {
-
-	match := filePatternRegex.FindStringSubmatch(filename)
-	if len(match) < 3 {
-		return "", 0, 0, fmt.Errorf("failed to match file name %s", filename)
-	}
-	result := make(map[string]string)
-	for i, name := range filePatternRegex.SubexpNames() {
-		if i != 0 && name != "" {
-			result[name] = match[i]
-		}
-	}
-
-	var err error
-	var seriesInt int64
-	if seriesStr, ok := result["series"]; ok && seriesStr != "" {
-		seriesInt, err = strconv.ParseInt(util.NormaliseNumericIdentifier(seriesStr), 10, 32)
-		if err != nil {
-			return "", 0, 0, fmt.Errorf("failed to parse matched series int %s: %w", seriesStr, err)
-		}
-	} else {
-		return "", 0, 0, fmt.Errorf("file pattern did not match series in : %s", filename)
-	}
-	var episodeInt int64
-	if episodeStr, ok := result["episode"]; ok && episodeStr != "" {
-		episodeInt, err = strconv.ParseInt(util.NormaliseNumericIdentifier(episodeStr), 10, 32)
-		if err != nil {
-			return "", 0, 0, fmt.Errorf("failed to parse matched episode int %s: %w", episodeStr, err)
-		}
-	} else {
-		return "", 0, 0, fmt.Errorf("file pattern did not match [episode]")
-	}
-	publication := ""
-	if publicationStr, ok := result["publication"]; ok && publicationStr != "" {
-		publication = publicationStr
-	}
-	return publication, int32(seriesInt), int32(episodeInt), nil
-}
-
 func parseSRT(filePath string) ([]model.Dialog, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
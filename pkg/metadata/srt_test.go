@@ -0,0 +1,31 @@
+package metadata
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestFindVideoFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{name: "webm", files: []string{"peepshow-S01E01.webm"}, want: "peepshow-S01E01.webm"},
+		{name: "mp4", files: []string{"peepshow-S01E01.mp4"}, want: "peepshow-S01E01.mp4"},
+		{name: "mkv", files: []string{"peepshow-S01E01.mkv", "peepshow-S01E02.mp4"}, want: "peepshow-S01E01.mkv"},
+		{name: "webm is preferred", files: []string{"peepshow-S01E01.mp4", "peepshow-S01E01.webm"}, want: "peepshow-S01E01.webm"},
+		{name: "missing", files: []string{"peepshow-S01E01.avi"}, want: "peepshow-S01E01.webm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range tt.files {
+				require.NoError(t, os.WriteFile(path.Join(dir, f), []byte{}, 0644))
+			}
+			require.Equal(t, tt.want, findVideoFile(dir, "peepshow-S01E01"))
+		})
+	}
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"github.com/warmans/tvgif/pkg/util"
+	"strings"
 	"time"
 )
 
@@ -11,6 +12,16 @@ type EpisodeMeta struct {
 	SourceSRTModTime time.Time `json:"source_srt_mod_time"`
 	ImportedIndex    bool      `json:"imported_index"`
 	ImportedDB       bool      `json:"imported_db"`
+	// SubtitleStream is set if the SRT was extracted from the video.
+	SubtitleStream *SubtitleStream `json:"subtitle_stream,omitempty"`
+}
+
+// SubtitleStream describes a subtitle stream within a video file.
+type SubtitleStream struct {
+	Index    int    `json:"index"`
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
 }
 
 type Dialog struct {
@@ -33,15 +44,111 @@ type Episode struct {
 	PublicationGroup string    `json:"publication_group"`
 	Series           int32     `json:"season"`
 	Episode          int32     `json:"episode"`
-	Dialog           []Dialog  `json:"dialog"`
+	// LastEpisode is set for multi-part episodes e.g. S01E01E02. Episode is the first part and is used in the ID.
+	LastEpisode int32    `json:"last_episode,omitempty"`
+	Dialog      []Dialog `json:"dialog"`
+	// Title, AirDate and ShowName are read from an optional NFO/JSON sidecar.
+	Title    string     `json:"title,omitempty"`
+	AirDate  *time.Time `json:"air_date,omitempty"`
+	ShowName string     `json:"show_name,omitempty"`
+	// Alignment is the correction that was applied to the SRT timestamps, if any.
+	Alignment *Alignment `json:"alignment,omitempty"`
+	// Offset is the manual correction that was applied on top of any alignment.
+	Offset *EpisodeOffset `json:"offset,omitempty"`
+	// Meta is information about how the episode was imported.
+	Meta *EpisodeMeta `json:"meta,omitempty"`
 }
 
 func (e *Episode) ID() string {
-	return fmt.Sprintf("%s-%s", e.Publication, util.FormatSeriesAndEpisode(int(e.Series), int(e.Episode)))
+	return util.FormatEpisodeID(e.Publication, e.Series, e.Episode)
+}
+
+func (e *Episode) Info() EpisodeInfo {
+	return EpisodeInfo{
+		Publication: e.Publication,
+		Series:      e.Series,
+		Episode:     e.Episode,
+		LastEpisode: e.LastEpisode,
+		Title:       e.Title,
+		AirDate:     e.AirDate,
+		ShowName:    e.ShowName,
+	}
+}
+
+// Alignment maps a subtitle timestamp to the video timestamp: t + Offset + t*Drift.
+type Alignment struct {
+	Offset time.Duration `json:"offset"`
+	Drift  float64       `json:"drift"`
+}
+
+func (a Alignment) Apply(ts time.Duration) time.Duration {
+	return ts + a.Offset + time.Duration(float64(ts)*a.Drift)
+}
+
+// EpisodeOffset is a manual correction of an episode's subtitle timestamps: t*Scale + Offset.
+type EpisodeOffset struct {
+	Publication string        `json:"publication" db:"publication"`
+	Series      int32         `json:"series" db:"series"`
+	Episode     int32         `json:"episode" db:"episode"`
+	Offset      time.Duration `json:"offset" db:"time_offset"`
+	Scale       float64       `json:"scale" db:"time_scale"`
+}
+
+func (o *EpisodeOffset) EpisodeID() string {
+	return util.FormatEpisodeID(o.Publication, o.Series, o.Episode)
+}
+
+// IsZero is true if the offset would not change any timestamps.
+func (o *EpisodeOffset) IsZero() bool {
+	return o.Offset == 0 && o.Scale == 1
+}
+
+// Apply corrects the dialog timestamps. Timestamps that would be negative are set to zero.
+func (o *EpisodeOffset) Apply(dialog []Dialog) []Dialog {
+	corrected := make([]Dialog, len(dialog))
+	for k, v := range dialog {
+		v.StartTimestamp = max(time.Duration(float64(v.StartTimestamp)*o.Scale)+o.Offset, 0)
+		v.EndTimestamp = max(time.Duration(float64(v.EndTimestamp)*o.Scale)+o.Offset, 0)
+		corrected[k] = v
+	}
+	return corrected
+}
+
+// EpisodeInfo is the descriptive information about an episode (if any was given during import).
+type EpisodeInfo struct {
+	Publication string     `json:"publication" db:"publication"`
+	Series      int32      `json:"series" db:"series"`
+	Episode     int32      `json:"episode" db:"episode"`
+	LastEpisode int32      `json:"last_episode" db:"last_episode"`
+	Title       string     `json:"title" db:"title"`
+	AirDate     *time.Time `json:"air_date" db:"air_date"`
+	ShowName    string     `json:"show_name" db:"show_name"`
+}
+
+// String e.g. Peep Show - Jeremy's Van (2003-09-19). Multi-part episodes include the range of episodes
+// e.g. Peep Show - S01E01-E02 - Jeremy's Van. Empty if there is no information.
+func (i EpisodeInfo) String() string {
+	parts := []string{}
+	if i.ShowName != "" {
+		parts = append(parts, i.ShowName)
+	}
+	if i.LastEpisode != 0 {
+		parts = append(parts, fmt.Sprintf("%s-E%02d", util.FormatSeriesAndEpisode(int(i.Series), int(i.Episode)), i.LastEpisode))
+	}
+	if i.Title != "" && i.Title != i.ShowName {
+		parts = append(parts, i.Title)
+	}
+	label := strings.Join(parts, " - ")
+	if i.AirDate != nil {
+		label = strings.TrimSpace(fmt.Sprintf("%s (%s)", label, i.AirDate.Format(time.DateOnly)))
+	}
+	return label
 }
 
 type Publication struct {
 	Name   string   `json:"name"`
 	Series []string `json:"series"`
 	Group  string   `json:"group"`
+	// DisplayName is the show name from the episode metadata, if any.
+	DisplayName string `json:"display_name"`
 }
@@ -0,0 +1,178 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/warmans/tvgif/pkg/discord/media"
+	model2 "github.com/warmans/tvgif/pkg/model"
+	"time"
+)
+
+// cacheKeyVersion should be incremented whenever the rendering changes in a way that invalidates cached files.
+const cacheKeyVersion = 1
+
+// cacheKey is a canonical representation of everything that affects the rendered output.
+type cacheKey struct {
+	Version         int               `json:"v"`
+	VideoFileName   string            `json:"video"`
+	Publication     string            `json:"pub"`
+	Dialog          []cacheKeyDialog  `json:"dialog"`
+	Start           time.Duration     `json:"start"`
+	End             time.Duration     `json:"end"`
+	OutputFileType  OutputFileType    `json:"type"`
+	FrameOffset     *time.Duration    `json:"frame_offset,omitempty"`
+	CustomText      []string          `json:"custom_text,omitempty"`
+	Caption         string            `json:"caption,omitempty"`
+	DisableSubs     bool              `json:"disable_subs,omitempty"`
+	SpecialMode     SpecialMode       `json:"mode,omitempty"`
+	StickerModeOpts *StickerModeOpts  `json:"sticker,omitempty"`
+	Overlays        []cacheKeyOverlay `json:"overlays,omitempty"`
+	ShowGrid        bool              `json:"grid,omitempty"`
+	SizeBudget      int64             `json:"size_budget,omitempty"`
+	Profiles        []EncodingProfile `json:"profiles,omitempty"`
+	Speed           float64           `json:"speed,omitempty"`
+	Reverse         bool              `json:"reverse,omitempty"`
+	Boomerang       bool              `json:"boomerang,omitempty"`
+	Composition     *cacheKeyComp     `json:"comp,omitempty"`
+	TextBlocks      []TextBlock       `json:"text_blocks,omitempty"`
+	ContactSheet    *cacheKeySheet    `json:"contact_sheet,omitempty"`
+}
+
+type cacheKeySheet struct {
+	Columns int           `json:"columns"`
+	Rows    int           `json:"rows"`
+	Padding time.Duration `json:"padding"`
+}
+
+type cacheKeyDialog struct {
+	Start   time.Duration `json:"start"`
+	End     time.Duration `json:"end"`
+	Content string        `json:"content"`
+}
+
+type cacheKeyOverlay struct {
+	Name    string            `json:"name"`
+	Hash    string            `json:"hash"`
+	X       float64           `json:"x"`
+	Y       float64           `json:"y"`
+	Scale   float64           `json:"scale"`
+	HFlip   bool              `json:"hflip,omitempty"`
+	Rotate  float64           `json:"rotate,omitempty"`
+	Opacity float64           `json:"opacity"`
+	Face    *int              `json:"face,omitempty"`
+	MoveTo  *[2]float64       `json:"move_to,omitempty"`
+	Timing  *[2]time.Duration `json:"timing,omitempty"`
+}
+
+type cacheKeyComp struct {
+	Layout CompositionLayout `json:"layout"`
+	Clips  []cacheKeyClip    `json:"clips"`
+}
+
+type cacheKeyClip struct {
+	VideoFileName string           `json:"video"`
+	Publication   string           `json:"pub"`
+	Dialog        []cacheKeyDialog `json:"dialog"`
+	Start         time.Duration    `json:"start"`
+	End           time.Duration    `json:"end"`
+}
+
+// createCacheKey creates a file name unique to the given render settings. Overlays should be given before
+// anchors are resolved so that a cached file can be found without needing to detect faces again.
+func createCacheKey(
+	videoFileName string,
+	customID *media.ID,
+	dialog []model2.Dialog,
+	opts *renderOpts,
+	overlays []overlay,
+	suffix string,
+) (string, error) {
+	key := cacheKey{
+		Version:         cacheKeyVersion,
+		VideoFileName:   videoFileName,
+		Publication:     customID.Publication,
+		Dialog:          cacheKeyDialogs(dialog),
+		Start:           opts.startTimestamp,
+		End:             opts.endTimestamp,
+		OutputFileType:  opts.outputFileType,
+		CustomText:      opts.customText,
+		Caption:         opts.caption,
+		DisableSubs:     opts.disableSubs,
+		SpecialMode:     opts.specialMode,
+		StickerModeOpts: opts.stickerModeOpts,
+		ShowGrid:        opts.showGrid,
+		SizeBudget:      opts.sizeBudget,
+		TextBlocks:      opts.textBlocks,
+	}
+	if isStillOutput(opts.outputFileType) {
+		offset := opts.resolveFrameOffset()
+		key.FrameOffset = &offset
+	} else {
+		key.Speed = opts.speed
+		key.Reverse = opts.reverse
+		key.Boomerang = opts.boomerang
+		if opts.sizeBudget > 0 {
+			key.Profiles = encodingProfiles
+		}
+	}
+	if opts.contactSheet != nil {
+		key.ContactSheet = &cacheKeySheet{
+			Columns: opts.contactSheet.columns,
+			Rows:    opts.contactSheet.rows,
+			Padding: opts.contactSheet.padding,
+		}
+	}
+	for _, ov := range overlays {
+		ko := cacheKeyOverlay{
+			Name:    ov.name,
+			Hash:    ov.hash,
+			X:       ov.x,
+			Y:       ov.y,
+			Scale:   ov.scale,
+			HFlip:   ov.hflip,
+			Rotate:  ov.rotate,
+			Opacity: ov.opacity,
+		}
+		if ov.anchor != nil {
+			ko.Face = &ov.anchor.face
+		}
+		if ov.moveTo != nil {
+			ko.MoveTo = &[2]float64{ov.moveTo.x, ov.moveTo.y}
+		}
+		if ov.timing != nil {
+			ko.Timing = &[2]time.Duration{ov.timing.start, ov.timing.end}
+		}
+		key.Overlays = append(key.Overlays, ko)
+	}
+	if len(opts.composition.clips) > 0 {
+		key.Composition = &cacheKeyComp{Layout: opts.composition.layout}
+		for _, clip := range opts.composition.clips {
+			key.Composition.Clips = append(key.Composition.Clips, cacheKeyClip{
+				VideoFileName: clip.VideoFileName,
+				Publication:   clip.Publication,
+				Dialog:        cacheKeyDialogs(clip.Dialog),
+				Start:         clip.StartTimestamp,
+				End:           clip.EndTimestamp,
+			})
+		}
+	}
+
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cache key: %w", err)
+	}
+	hash := sha256.Sum256(encoded)
+
+	// the dialog ID is retained to make it easier to find files in the cache dir.
+	return fmt.Sprintf("%s-%s.%s", customID.DialogID(), hex.EncodeToString(hash[:12]), suffix), nil
+}
+
+func cacheKeyDialogs(dialog []model2.Dialog) []cacheKeyDialog {
+	out := make([]cacheKeyDialog, 0, len(dialog))
+	for _, d := range dialog {
+		out = append(out, cacheKeyDialog{Start: d.StartTimestamp, End: d.EndTimestamp, Content: d.Content})
+	}
+	return out
+}
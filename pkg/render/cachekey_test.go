@@ -0,0 +1,60 @@
+package render
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/warmans/tvgif/pkg/discord/media"
+	"github.com/warmans/tvgif/pkg/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateCacheKey(t *testing.T) {
+	customID := &media.ID{Publication: "peepshow", Series: 1, Episode: 2, StartPosition: 10}
+	dialog := []model.Dialog{{Pos: 10, StartTimestamp: time.Second, EndTimestamp: time.Second * 2, Content: "Hello"}}
+	baseOpts := []Option{WithStartTimestamp(time.Second), WithEndTimestamp(time.Second * 2)}
+	offset := time.Millisecond * 200
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		overlays []overlay
+	}{
+		{name: "default"},
+		{name: "gif", opts: []Option{WithOutputFileType(OutputGif)}},
+		{name: "shifted", opts: []Option{WithStartTimestamp(time.Second * 2), WithEndTimestamp(time.Second * 3)}},
+		{name: "custom text", opts: []Option{WithCustomText([]string{"Goodbye"})}},
+		{name: "caption", opts: []Option{WithCaptionMode(true), WithCaption("foo")}},
+		{name: "text blocks", opts: []Option{WithCaptionMode(true), WithTextBlocks([]TextBlock{{Text: "foo"}})}},
+		{name: "sticker", opts: []Option{WithStickerMode(true, &StickerModeOpts{X: 1})}},
+		{name: "speed", opts: []Option{WithSpeed(2)}},
+		{name: "size budget", opts: []Option{WithSizeBudget(1024)}},
+		{name: "grid", opts: []Option{WithGrid(true)}},
+		{name: "still", opts: []Option{WithOutputFileType(OutputPng)}},
+		{name: "still with offset", opts: []Option{WithOutputFileType(OutputPng), WithFrameOffset(&offset)}},
+		{name: "composition", opts: []Option{WithComposition(CompositionHStack, []Clip{{VideoFileName: "foo.webm"}})}},
+		{name: "overlay", overlays: []overlay{{name: "foo.png", x: 1, y: 1, scale: 1, opacity: 1}}},
+		{name: "replaced overlay", overlays: []overlay{{name: "foo.png", hash: "abc", x: 1, y: 1, scale: 1, opacity: 1}}},
+		{name: "anchored overlay", overlays: []overlay{{name: "foo.png", x: 1, y: 1, scale: 1, opacity: 1, anchor: &overlayAnchor{face: 0}}}},
+	}
+
+	seen := map[string]string{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			create := func() string {
+				key, err := createCacheKey("peepshow-S01E02.webm", customID, dialog, resolveRenderOpts(append(baseOpts, tt.opts...)...), tt.overlays, "webp")
+				require.NoError(t, err)
+				return key
+			}
+			key := create()
+			require.Equal(t, key, create(), "key should be stable")
+			require.True(t, strings.HasPrefix(key, customID.DialogID()+"-"))
+			require.True(t, strings.HasSuffix(key, ".webp"))
+
+			if other, ok := seen[key]; ok {
+				t.Fatalf("key collides with %s", other)
+			}
+			seen[key] = tt.name
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package render
+
+import (
+	"fmt"
+	"github.com/warmans/tvgif/pkg/discord/media"
+	model2 "github.com/warmans/tvgif/pkg/model"
+	"github.com/warmans/tvgif/pkg/util"
+	"math"
+	"path"
+	"strings"
+	"time"
+)
+
+// contactSheetTileWidth is the width of each frame in a contact sheet.
+const contactSheetTileWidth = 240
+
+// Command is a complete description of an ffmpeg invocation. Input paths are relative to the media dir
+// so the same command can be executed by any backend that has the media available.
+// Output is always written to stdout.
+type Command struct {
+	Inputs      []Input  `json:"inputs"`
+	FilterGraph string   `json:"filter_graph,omitempty"`
+	OutputArgs  []string `json:"output_args,omitempty"`
+}
+
+type Input struct {
+	// Args are input options e.g. -ss
+	Args []string `json:"args,omitempty"`
+	// Path is relative to the media dir.
+	Path string `json:"path"`
+}
+
+// Args gets the ffmpeg arguments with inputs resolved relative to the given media path.
+func (c Command) Args(mediaPath string) []string {
+	args := []string{}
+	for _, in := range c.Inputs {
+		args = append(args, in.Args...)
+		args = append(args, "-i", path.Join(mediaPath, in.Path))
+	}
+	if c.FilterGraph != "" {
+		args = append(args, "-filter_complex", c.FilterGraph)
+	}
+	args = append(args, c.OutputArgs...)
+	return append(args, "pipe:")
+}
+
+func (c Command) String() string {
+	return strings.Join(c.Args(""), " ")
+}
+
+// buildCommand creates the ffmpeg command for the given output type and encoding profile.
+func buildCommand(
+	videoFileName string,
+	customID *media.ID,
+	dialog []model2.Dialog,
+	opts *renderOpts,
+	overlays []overlay,
+	profile EncodingProfile,
+) (Command, error) {
+
+	if opts.contactSheet != nil {
+		return buildContactSheetCommand(videoFileName, opts), nil
+	}
+
+	inputs, filter := createInputsAndFilter(videoFileName, customID, dialog, opts, overlays, profile)
+	cmd := Command{Inputs: inputs, FilterGraph: filter}
+
+	switch opts.outputFileType {
+	case OutputGif, OutputWebp:
+		cmd.OutputArgs = []string{
+			"-f", string(opts.outputFileType),
+			// for some reason this is necessary for discord to display webp images.
+			// it doesn't actually stop it from looping or affect gifs...
+			"-loop", "0",
+			"-quality", fmt.Sprintf("%d", profile.Quality),
+		}
+	case OutputWebm:
+		cmd.OutputArgs = []string{
+			"-map_metadata", "-1",
+			"-f", "webm",
+		}
+		if hasTimeEffect(opts) {
+			// the audio would no longer match the video.
+			cmd.OutputArgs = append(cmd.OutputArgs, "-an")
+		}
+	case OutputPng, OutputJpeg:
+		// output seeking is used so the filters still see timestamps relative to the start of the clip.
+		cmd.OutputArgs = []string{
+			"-ss", fmt.Sprintf("%0.2f", opts.resolveFrameOffset().Seconds()),
+			"-frames:v", "1",
+			"-f", "image2pipe",
+		}
+		if opts.outputFileType == OutputJpeg {
+			cmd.OutputArgs = append(cmd.OutputArgs, "-c:v", "mjpeg", "-q:v", "2")
+		} else {
+			cmd.OutputArgs = append(cmd.OutputArgs, "-c:v", "png")
+		}
+	default:
+		return Command{}, fmt.Errorf("unsupported output type: %s", opts.outputFileType)
+	}
+	return cmd, nil
+}
+
+// buildContactSheetCommand creates a command to output a single image containing a grid of frames from the clip.
+// Each frame is labeled with its time relative to the start of the clip so negative times are in the padding.
+func buildContactSheetCommand(videoFileName string, opts *renderOpts) Command {
+	sheet := opts.contactSheet
+
+	startTimestamp := max(opts.startTimestamp-sheet.padding, 0)
+	endTimestamp := opts.endTimestamp + sheet.padding
+	duration := max(endTimestamp-startTimestamp, time.Millisecond*100)
+
+	return Command{
+		Inputs: []Input{
+			{
+				Args: []string{
+					"-ss", fmt.Sprintf("%0.2f", startTimestamp.Seconds()),
+					"-to", fmt.Sprintf("%0.2f", endTimestamp.Seconds()),
+				},
+				Path: videoFileName,
+			},
+		},
+		FilterGraph: fmt.Sprintf(
+			"[0:v]fps=%d/%0.3f,scale=%d:-2,drawtext=text='%%{pts\\:hms\\:%0.2f}':fontcolor=white:fontsize=14:box=1:boxcolor=black@0.6:boxborderw=4:x=4:y=4,tile=%dx%d:padding=4:margin=4",
+			sheet.columns*sheet.rows,
+			duration.Seconds(),
+			contactSheetTileWidth,
+			(startTimestamp - opts.startTimestamp).Seconds(),
+			sheet.columns,
+			sheet.rows,
+		),
+		OutputArgs: []string{
+			"-frames:v", "1",
+			"-f", "image2pipe",
+			"-c:v", "mjpeg",
+			"-q:v", "3",
+		},
+	}
+}
+
+func createInputsAndFilter(
+	videoFileName string,
+	customID *media.ID,
+	dialog []model2.Dialog,
+	opts *renderOpts,
+	resolvedOverlays []overlay,
+	profile EncodingProfile,
+) ([]Input, string) {
+
+	//video input
+	inputs := []Input{
+		{
+			Args: []string{
+				"-ss", fmt.Sprintf("%0.2f", opts.startTimestamp.Seconds()),
+				"-to", fmt.Sprintf("%0.2f", opts.endTimestamp.Seconds()),
+			},
+			Path: videoFileName,
+		},
+	}
+
+	filterPrefix := ""
+	filtersStartAt := "0:v"
+	drawSubs := !opts.disableSubs
+
+	if len(opts.composition.clips) > 0 {
+		for _, clip := range opts.composition.clips {
+			inputs = append(inputs, Input{
+				Args: []string{
+					"-ss", fmt.Sprintf("%0.2f", clip.StartTimestamp.Seconds()),
+					"-to", fmt.Sprintf("%0.2f", clip.EndTimestamp.Seconds()),
+				},
+				Path: clip.VideoFileName,
+			})
+		}
+		filterPrefix += createCompositionFilter(customID, dialog, opts)
+		filtersStartAt = "comp"
+		// subs are drawn onto each clip before they are combined
+		drawSubs = false
+	}
+	overlayInputOffset := len(inputs)
+
+	// e.g. ffmpeg -i sample.mp4 -an -stream_loop -1 -i gif/hearts-1.gif -ignore_loop 0 -i sparkles.gif -ignore_loop 0 -filter_complex "[0][1]overlay=x=W/2-w/2:y=H/2-h/2:shortest=1[out];[out][2]overlay=x=W/2-w/2:y=H/2-h/2:shortest=1" sample_with_gif.gif
+	if len(resolvedOverlays) > 0 {
+		// resize all inputs
+		for i, overlayConf := range resolvedOverlays {
+			filterPrefix += fmt.Sprintf(
+				"[%d]scale=w=iw*%0.2f:h=ih*%0.2f%s%s%s[i%d];",
+				i+overlayInputOffset,
+				overlayConf.scale,
+				overlayConf.scale,
+				util.IfElse(overlayConf.hflip, ",hflip", ""),
+				util.IfElse(
+					overlayConf.rotate != 0,
+					fmt.Sprintf(",format=rgba,rotate=a=%[1]f:c=none:ow='rotw(%[1]f)':oh='roth(%[1]f)'", overlayConf.rotate*math.Pi/180),
+					"",
+				),
+				util.IfElse(
+					overlayConf.opacity < 1,
+					fmt.Sprintf(",format=rgba,colorchannelmixer=aa=%0.2f", overlayConf.opacity),
+					"",
+				),
+				i+1,
+			)
+		}
+
+		clipDuration := opts.endTimestamp - opts.startTimestamp
+		for i, overlayConf := range resolvedOverlays {
+
+			xCell, yCell := overlayConf.cellExpressions(clipDuration)
+
+			// This should align the center of the gif with the center of the chosen grid square
+			// 1. get the top left of a grid square
+			// 2. add half the width/height of a grid squareso the image is placed in the middle
+			// 3. offset the overlay position by half its size so the middle of the overlay aligns with the middle of the grid square.
+			filterPrefix += fmt.Sprintf(
+				"[%s][i%d]overlay=x='((((W/%d)*%s)+((W/%d)/2))-w/2)':y='((((H/%d)*%s)+((H/%d)/2))-h/2)':shortest=1%s[o%d];",
+				util.IfElse(i == 0, filtersStartAt, fmt.Sprintf("o%d", i-1)),
+				i+1,
+				overlayGridSizeX,
+				xCell,
+				overlayGridSizeX,
+				overlayGridSizeY,
+				yCell,
+				overlayGridSizeY,
+				overlayConf.enableExpression(),
+				i,
+			)
+
+			if overlayConf.animated {
+				inputs = append(inputs, Input{
+					Args: []string{"-ignore_loop", "0"},
+					Path: path.Join("overlay", overlayConf.name),
+				})
+			} else {
+				// static images must be looped to last the length of the clip.
+				inputs = append(inputs, Input{
+					Args: []string{"-f", "image2", "-pattern_type", "none", "-loop", "1"},
+					Path: path.Join("overlay", overlayConf.name),
+				})
+			}
+		}
+
+		filtersStartAt = fmt.Sprintf("o%d", len(resolvedOverlays)-1)
+	}
+
+	still := isStillOutput(opts.outputFileType)
+
+	return inputs, fmt.Sprintf(
+		"%s%s",
+		filterPrefix,
+		joinFilters(
+			filtersStartAt,
+			onlyIf(
+				drawSubs,
+				createDrawtextFilter(
+					dialog,
+					opts,
+					withSimpsonsFont(customID.Publication == "simpsons"),
+				),
+			),
+			createStickerCropFilter(opts),
+			createStickerResizeFilter(opts),
+			createCaptionScaleFilter(opts),
+			onlyIf(opts.showGrid, createGridFilter(overlayGridSizeX, overlayGridSizeY)),
+			createDrawtextCaptionFilter(opts.caption),
+			createDrawtextBlocksFilter(opts.textBlocks),
+			// time effects must come after drawtext so subtitles are still timed against the original clip.
+			onlyIf(!still, createSpeedFilter(opts)),
+			onlyIf(!still, createReverseFilter(opts)),
+			onlyIf(!still, createBoomerangFilter(opts)),
+			createProfileFilter(profile),
+		),
+	)
+}
@@ -0,0 +1,182 @@
+package render
+
+import (
+	"flag"
+	"github.com/stretchr/testify/require"
+	"github.com/warmans/tvgif/pkg/discord/media"
+	"github.com/warmans/tvgif/pkg/model"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestBuildCommand(t *testing.T) {
+	customID := &media.ID{Publication: "peepshow", Series: 1, Episode: 2, StartPosition: 10, EndPosition: 11}
+	dialog := []model.Dialog{
+		{Pos: 10, StartTimestamp: time.Second * 60, EndTimestamp: time.Second * 62, Content: "Hello there"},
+		{Pos: 11, StartTimestamp: time.Second * 62, EndTimestamp: time.Second * 64, Content: "General Kenobi"},
+	}
+	clipOpts := []Option{
+		WithStartTimestamp(time.Second * 60),
+		WithEndTimestamp(time.Second * 64),
+	}
+	frameOffset := time.Millisecond * 1500
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		overlays []overlay
+		profile  EncodingProfile
+	}{
+		{
+			name: "gif",
+			opts: []Option{WithOutputFileType(OutputGif)},
+		},
+		{
+			name: "webp",
+			opts: []Option{WithOutputFileType(OutputWebp)},
+		},
+		{
+			name: "webm",
+			opts: []Option{WithOutputFileType(OutputWebm)},
+		},
+		{
+			name:    "webp_reduced_profile",
+			opts:    []Option{WithOutputFileType(OutputWebp)},
+			profile: encodingProfiles[2],
+		},
+		{
+			name: "sticker",
+			opts: []Option{WithOutputFileType(OutputWebp), WithStickerMode(true, &StickerModeOpts{X: 10, Y: -5, WidthOffset: 20})},
+		},
+		{
+			name: "caption",
+			opts: []Option{
+				WithOutputFileType(OutputWebp),
+				WithCaptionMode(true),
+				WithCaption("a caption"),
+				WithTextBlocks([]TextBlock{
+					{Text: "TOP TEXT", Position: TextTop, Colour: "white", Size: 32},
+					{Text: "later", Position: TextCustom, X: 10, Y: 20, Colour: "#ff0000", Size: 20, Start: time.Second, End: time.Second * 2},
+				}),
+			},
+		},
+		{
+			name: "boomer_overlays",
+			opts: []Option{WithOutputFileType(OutputWebp), WithGrid(true)},
+			overlays: []overlay{
+				{name: "hearts.gif", x: 1, y: 2, scale: 1, opacity: 1, animated: true},
+				{name: "sunglasses.png", x: 3, y: 1, scale: 0.5, hflip: true, rotate: 45, opacity: 0.5},
+				{
+					name:    "sparkles.webp",
+					x:       0,
+					y:       0,
+					scale:   2,
+					opacity: 1,
+					moveTo:  &overlayCell{x: 6, y: 4},
+					timing:  &overlayTiming{start: time.Second, end: time.Second * 3},
+				},
+			},
+		},
+		{
+			name: "png",
+			opts: []Option{WithOutputFileType(OutputPng), WithFrameOffset(&frameOffset), WithSpeed(2)},
+		},
+		{
+			name: "jpeg",
+			opts: []Option{WithOutputFileType(OutputJpeg)},
+		},
+		{
+			name: "composition_sequence",
+			opts: []Option{
+				WithOutputFileType(OutputWebp),
+				WithComposition(CompositionSequence, []Clip{
+					{
+						VideoFileName:  "peepshow-S01E03.webm",
+						Publication:    "peepshow",
+						Dialog:         []model.Dialog{{Pos: 1, StartTimestamp: time.Second * 5, EndTimestamp: time.Second * 6, Content: "Another clip"}},
+						StartTimestamp: time.Second * 5,
+						EndTimestamp:   time.Second * 6,
+					},
+				}),
+			},
+		},
+		{
+			name: "composition_hstack",
+			opts: []Option{
+				WithOutputFileType(OutputWebp),
+				WithComposition(CompositionHStack, []Clip{
+					{
+						VideoFileName:  "peepshow-S01E03.webm",
+						Publication:    "peepshow",
+						StartTimestamp: time.Second * 5,
+						EndTimestamp:   time.Second * 6,
+					},
+				}),
+			},
+		},
+		{
+			name: "playback_effects",
+			opts: []Option{WithOutputFileType(OutputWebp), WithSpeed(0.5), WithReverse(true), WithBoomerang(true)},
+		},
+		{
+			name: "webm_speed",
+			opts: []Option{WithOutputFileType(OutputWebm), WithSpeed(2)},
+		},
+		{
+			name: "no_subs",
+			opts: []Option{WithOutputFileType(OutputWebp), WithDisableSubs(true)},
+		},
+		{
+			name: "contact_sheet",
+			opts: []Option{WithOutputFileType(OutputWebp), WithContactSheet(4, 3, time.Second)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := tt.profile
+			if profile == (EncodingProfile{}) {
+				profile = defaultEncodingProfile
+			}
+			cmd, err := buildCommand(
+				"peepshow-S01E02.webm",
+				customID,
+				dialog,
+				resolveRenderOpts(append(clipOpts, tt.opts...)...),
+				tt.overlays,
+				profile,
+			)
+			require.NoError(t, err)
+
+			require.NoError(t, validateCommand(cmd), "render workers must accept every command the renderer creates")
+
+			// one argument per line keeps the diffs readable
+			got := strings.Join(cmd.Args("/media"), "\n") + "\n"
+
+			goldenPath := path.Join("testdata", tt.name+".golden")
+			if *updateGolden {
+				require.NoError(t, os.MkdirAll("testdata", 0755))
+				require.NoError(t, os.WriteFile(goldenPath, []byte(got), 0644))
+			}
+			want, err := os.ReadFile(goldenPath)
+			require.NoError(t, err, "golden file missing, run with -update to create it")
+			require.Equal(t, string(want), got)
+		})
+	}
+}
+
+func TestBuildCommand_UnsupportedOutputType(t *testing.T) {
+	_, err := buildCommand(
+		"peepshow-S01E02.webm",
+		&media.ID{Publication: "peepshow"},
+		nil,
+		resolveRenderOpts(WithOutputFileType("bmp")),
+		nil,
+		defaultEncodingProfile,
+	)
+	require.Error(t, err)
+}
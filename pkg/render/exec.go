@@ -3,17 +3,15 @@ package render
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/bwmarrin/discordgo"
 	"github.com/warmans/tvgif/pkg/discord/media"
 	"github.com/warmans/tvgif/pkg/mediacache"
 	model2 "github.com/warmans/tvgif/pkg/model"
-	"github.com/warmans/tvgif/pkg/util"
 	"io"
 	"log/slog"
-	"os"
-	"os/exec"
-	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -22,24 +20,38 @@ import (
 const overlayGridSizeX = 7
 const overlayGridSizeY = 5
 
+// profileKeySuffix is added to a file's cache key to get the key of the encoding profile it was rendered with.
+const profileKeySuffix = ".profile.json"
+
+var errProfileUnknown = errors.New("encoding profile of cached file is unknown")
+
 type Renderer interface {
 	RenderFile(
 		videoFileName string,
 		customID *media.ID,
 		dialog []model2.Dialog,
 		opt ...Option,
-	) (*discordgo.File, error)
+	) (*Result, error)
 }
 
-func NewExecRenderer(cache *mediacache.Cache, mediaPath string, logger *slog.Logger, overlayCache *mediacache.OverlayCache) *ExecRenderer {
-	return &ExecRenderer{mediaCache: cache, mediaPath: mediaPath, logger: logger, overlayCache: overlayCache}
+type Result struct {
+	File *discordgo.File
+	// Profile is the encoding profile that was needed to fit the output into the size budget.
+	// It will be nil if no reduction was required.
+	Profile *EncodingProfile
 }
 
+func NewExecRenderer(cache *mediacache.Cache, logger *slog.Logger, overlayCache *mediacache.OverlayCache, executor Executor) *ExecRenderer {
+	return &ExecRenderer{mediaCache: cache, logger: logger, overlayCache: overlayCache, executor: executor}
+}
+
+// ExecRenderer builds ffmpeg commands and runs them with the given Executor.
 type ExecRenderer struct {
 	mediaCache   *mediacache.Cache
-	mediaPath    string
 	logger       *slog.Logger
 	overlayCache *mediacache.OverlayCache
+	executor     Executor
+	sceneCuts    sceneCutCache
 }
 
 func (r *ExecRenderer) RenderFile(
@@ -47,147 +59,125 @@ func (r *ExecRenderer) RenderFile(
 	customID *media.ID,
 	dialog []model2.Dialog,
 	opt ...Option,
-) (*discordgo.File, error) {
+) (*Result, error) {
 
 	opts := resolveRenderOpts(opt...)
 
 	var mimeType string
 	var extension string
+	var chosenProfile *EncodingProfile
 	buff := &bytes.Buffer{}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	defer cancel()
-
 	switch opts.outputFileType {
-	case OutputGif, OutputWebp:
-
+	case OutputGif:
 		mimeType = "image/gif"
 		extension = "gif"
-		format := "gif"
-		if opts.outputFileType == OutputWebp {
-			mimeType = "image/webp"
-			extension = "webp"
-			format = "webp"
-		}
+	case OutputWebp:
+		mimeType = "image/webp"
+		extension = "webp"
+	case OutputWebm:
+		mimeType = "video/webm"
+		extension = "webm"
+	case OutputPng:
+		mimeType = "image/png"
+		extension = "png"
+	case OutputJpeg:
+		mimeType = "image/jpeg"
+		extension = "jpg"
+	default:
+		return nil, fmt.Errorf("unsupported output type: %s", opts.outputFileType)
+	}
 
-		resolvedOverlays := opts.overlayConfig.resolveOverlays(r.overlayCache, r.logger)
-		_, err := r.mediaCache.Get(createFileName(customID, extension), buff, opts.disableCaching || len(resolvedOverlays) > 0, func(writer io.Writer) error {
-			//video input
-			args := [][]string{
-				{
-					"-ss", fmt.Sprintf("%0.2f", opts.startTimestamp.Seconds()),
-					"-to", fmt.Sprintf("%0.2f", opts.endTimestamp.Seconds()),
-					"-i", path.Join(r.mediaPath, videoFileName),
-				},
-			}
+	overlays := opts.overlayConfig.resolveOverlays(r.overlayCache, r.logger)
 
-			filterPrefix := ""
-			filtersStartAt := "0:v"
-
-			// e.g. ffmpeg -i sample.mp4 -an -stream_loop -1 -i gif/hearts-1.gif -ignore_loop 0 -i sparkles.gif -ignore_loop 0 -filter_complex "[0][1]overlay=x=W/2-w/2:y=H/2-h/2:shortest=1[out];[out][2]overlay=x=W/2-w/2:y=H/2-h/2:shortest=1" sample_with_gif.gif
-			if len(resolvedOverlays) > 0 {
-				// resize all inputs
-				for i, overlayConf := range resolvedOverlays {
-					filterPrefix += fmt.Sprintf(
-						"[%d]scale=w=iw*%0.2f:h=ih*%0.2f%s[i%d];",
-						i+1,
-						overlayConf.scale,
-						overlayConf.scale,
-						util.IfElse(overlayConf.hflip, ",hflip", ""),
-						i+1,
-					)
-				}
+	cacheKey, err := createCacheKey(videoFileName, customID, dialog, opts, overlays, extension)
+	if err != nil {
+		return nil, err
+	}
 
-				for i, overlayConf := range resolvedOverlays {
-
-					// This should align the center of the gif with the center of the chosen grid square
-					// 1. get the top left of a grid square
-					// 2. add half the width/height of a grid squareso the image is placed in the middle
-					// 3. offset the overlay position by half its size so the middle of the overlay aligns with the middle of the grid square.
-					filterPrefix += fmt.Sprintf(
-						"[%s][i%d]overlay=x=((((W/%d)*%0.2f)+((W/%d)/2))-w/2):y=((((H/%d)*%0.2f)+((H/%d)/2))-h/2):shortest=1:[o%d];",
-						util.IfElse(i == 0, "0", fmt.Sprintf("o%d", i-1)),
-						i+1,
-						overlayGridSizeX,
-						overlayConf.x,
-						overlayGridSizeX,
-						overlayGridSizeY,
-						overlayConf.y,
-						overlayGridSizeY,
-						i,
-					)
-
-					args = append(args, []string{
-						//"-stream_loop", "-1",
-						"-ignore_loop", "0",
-						"-i", path.Join(r.mediaPath, "overlay", overlayConf.name),
-					})
-				}
+	hit, err := r.mediaCache.Get(cacheKey, buff, false, func(writer io.Writer) error {
+		resolvedOverlays := r.resolveAnchors(videoFileName, opts, overlays)
 
-				filtersStartAt = fmt.Sprintf("o%d", len(resolvedOverlays)-1)
+		// stills are always small enough so there is no need to try other profiles.
+		profiles := []EncodingProfile{defaultEncodingProfile}
+		if opts.sizeBudget > 0 && !isStillOutput(opts.outputFileType) {
+			profiles = encodingProfiles
+		}
+		for k, profile := range profiles {
+			cmd, err := buildCommand(videoFileName, customID, dialog, opts, resolvedOverlays, profile)
+			if err != nil {
+				return err
 			}
-
-			// output
-			args = append(args, []string{
-				"-f", format,
-				//"-ignore_loop", "0",
-				"-loop", "0",
-				"-quality", "90",
-				"-filter_complex",
-				fmt.Sprintf(
-					"%s%s",
-					filterPrefix,
-					joinFilters(
-						filtersStartAt,
-						onlyIf(
-							!opts.disableSubs,
-							createDrawtextFilter(
-								dialog,
-								opts,
-								withSimpsonsFont(customID.Publication == "simpsons"),
-							),
-						),
-						createStickerCropFilter(opts),
-						createStickerResizeFilter(opts),
-						createCaptionScaleFilter(opts),
-						onlyIf(opts.showGrid, createGridFilter(overlayGridSizeX, overlayGridSizeY)),
-						createDrawtextCaptionFilter(opts.caption),
-					)),
-				"pipe:",
-			})
-
-			finalArgs := flattenArgs(args)
-
-			r.logger.Info("Compiled command", slog.String("cmd", strings.Join(finalArgs, " ")))
-
-			cmd := exec.CommandContext(ctx, "ffmpeg", finalArgs...)
-			cmd.Stdout = writer
-			cmd.Stderr = os.Stderr
-
-			return cmd.Run()
-		})
-		if err != nil {
-			return nil, err
+			attempt := &bytes.Buffer{}
+			if err := r.execute(cmd, attempt); err != nil {
+				return err
+			}
+			if opts.sizeBudget == 0 || int64(attempt.Len()) <= opts.sizeBudget {
+				if k > 0 {
+					chosenProfile = &profile
+				}
+				_, err := io.Copy(writer, attempt)
+				return err
+			}
+			r.logger.Info(
+				"Output exceeded size budget",
+				slog.Int("size", attempt.Len()),
+				slog.Int64("budget", opts.sizeBudget),
+				slog.String("profile", profile.String()),
+			)
 		}
-
-	default:
-		return nil, fmt.Errorf("Not supported")
+		return fmt.Errorf("output could not be reduced to fit within %d bytes", opts.sizeBudget)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opts.sizeBudget > 0 && !isStillOutput(opts.outputFileType) {
+		chosenProfile = r.cachedProfile(cacheKey, hit, chosenProfile)
 	}
 
-	return &discordgo.File{
-		Name:        createFileName(customID, extension),
-		ContentType: mimeType,
-		Reader:      buff,
+	return &Result{
+		File: &discordgo.File{
+			Name:        createFileName(customID, opts, extension),
+			ContentType: mimeType,
+			Reader:      buff,
+		},
+		Profile: chosenProfile,
 	}, nil
+}
 
+// cachedProfile stores the encoding profile the file was rendered with alongside it in the cache, so it is
+// still known when the file is served from the cache.
+func (r *ExecRenderer) cachedProfile(cacheKey string, hit bool, rendered *EncodingProfile) *EncodingProfile {
+	buff := &bytes.Buffer{}
+	_, err := r.mediaCache.Get(cacheKey+profileKeySuffix, buff, false, func(writer io.Writer) error {
+		if hit {
+			// the profile was evicted before the file.
+			return errProfileUnknown
+		}
+		return json.NewEncoder(writer).Encode(rendered)
+	})
+	if err != nil {
+		if !errors.Is(err, errProfileUnknown) {
+			r.logger.Warn("Failed to get cached encoding profile", slog.String("key", cacheKey), slog.String("err", err.Error()))
+		}
+		return rendered
+	}
+	var profile *EncodingProfile
+	if err := json.Unmarshal(buff.Bytes(), &profile); err != nil {
+		r.logger.Warn("Invalid cached encoding profile", slog.String("key", cacheKey), slog.String("err", err.Error()))
+		return rendered
+	}
+	return profile
 }
 
-func flattenArgs(args [][]string) []string {
-	out := []string{}
-	for _, a := range args {
-		out = append(out, a...)
+func (r *ExecRenderer) execute(cmd Command, writer io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	if err := r.executor.Execute(ctx, cmd, writer); err != nil {
+		return fmt.Errorf("ffmpeg command failed: %w", err)
 	}
-	return out
+	return nil
 }
 
 type overlayConfig struct {
@@ -209,21 +199,21 @@ func (o overlayConfig) resolveOverlays(overlayCache *mediacache.OverlayCache, lo
 			return out
 		}
 
-		xy := strings.Split(parts[0], "x")
-		if len(xy) != 2 {
-			logger.Error("XY did not have enough elements", slog.String("line", line), slog.String("xy", parts[0]))
-			return out
-		}
+		// position may either be a single cell e.g. 1x2 or a movement between two cells e.g. 1x2->3x4
+		positions := strings.SplitN(parts[0], "->", 2)
 
-		x, err := strconv.ParseFloat(xy[0], 64)
-		if err != nil {
-			logger.Error("failed to parse X", slog.String("line", line), slog.String("x", xy[0]))
-			return out
+		var anchor *overlayAnchor
+		var x, y float64
+		var err error
+		if strings.HasPrefix(positions[0], "@") {
+			anchor, err = parseOverlayAnchor(positions[0])
+			// anchored overlays fall back to the middle of the grid if the anchor cannot be found
+			x, y = float64(overlayGridSizeX-1)/2, float64(overlayGridSizeY-1)/2
+		} else {
+			x, y, err = parseOverlayCell(positions[0])
 		}
-
-		y, err := strconv.ParseFloat(xy[1], 64)
 		if err != nil {
-			logger.Error("failed to parse Y", slog.String("line", line), slog.String("y", xy[1]))
+			logger.Error("failed to parse position", slog.String("line", line), slog.String("err", err.Error()))
 			return out
 		}
 
@@ -236,17 +226,55 @@ func (o overlayConfig) resolveOverlays(overlayCache *mediacache.OverlayCache, lo
 			}
 		}
 
-		ov := overlay{name: parts[1], x: x, y: y, scale: min(scale, 5), hflip: false}
+		ov := overlay{name: parts[1], x: x, y: y, scale: min(scale, 5), hflip: false, opacity: 1, anchor: anchor}
+		if len(positions) > 1 {
+			toX, toY, err := parseOverlayCell(positions[1])
+			if err != nil {
+				logger.Error("failed to parse destination position", slog.String("line", line), slog.String("err", err.Error()))
+				return out
+			}
+			ov.moveTo = &overlayCell{x: toX, y: toY}
+		}
 		if len(parts) > 3 {
-			for _, v := range strings.Split(parts[3], "") {
-				switch v {
-				case "f":
-					ov.hflip = true
+			for _, arg := range strings.Fields(parts[3]) {
+				if strings.HasPrefix(arg, "t=") {
+					timing, err := parseOverlayTiming(strings.TrimPrefix(arg, "t="))
+					if err != nil {
+						logger.Error("failed to parse timing", slog.String("line", line), slog.String("err", err.Error()))
+						return out
+					}
+					ov.timing = timing
+					continue
+				}
+				if strings.HasPrefix(arg, "r=") {
+					ov.rotate, err = strconv.ParseFloat(strings.TrimPrefix(arg, "r="), 64)
+					if err != nil {
+						logger.Error("failed to parse rotation", slog.String("line", line), slog.String("err", err.Error()))
+						return out
+					}
+					continue
+				}
+				if strings.HasPrefix(arg, "o=") {
+					opacity, err := strconv.ParseFloat(strings.TrimPrefix(arg, "o="), 64)
+					if err != nil {
+						logger.Error("failed to parse opacity", slog.String("line", line), slog.String("err", err.Error()))
+						return out
+					}
+					ov.opacity = max(min(opacity, 1), 0)
+					continue
+				}
+				for _, v := range strings.Split(arg, "") {
+					switch v {
+					case "f":
+						ov.hflip = true
+					}
 				}
 			}
 		}
 
-		if overlayCache.Exists(ov.name) {
+		if cached, ok := overlayCache.Get(ov.name); ok {
+			ov.animated = cached.Animated
+			ov.hash = cached.Hash
 			out = append(out, ov)
 		} else {
 			logger.Error("image does not exist", slog.String("line", line))
@@ -256,9 +284,112 @@ func (o overlayConfig) resolveOverlays(overlayCache *mediacache.OverlayCache, lo
 	return out
 }
 
+// parseOverlayCell parses a grid position e.g. 1x2.5
+func parseOverlayCell(raw string) (float64, float64, error) {
+	xy := strings.Split(raw, "x")
+	if len(xy) != 2 {
+		return 0, 0, fmt.Errorf("XY did not have enough elements: %s", raw)
+	}
+	x, err := strconv.ParseFloat(xy[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse X %s: %w", xy[0], err)
+	}
+	y, err := strconv.ParseFloat(xy[1], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse Y %s: %w", xy[1], err)
+	}
+	return x, y, nil
+}
+
+// parseOverlayAnchor parses an anchor e.g. @face0 which is the first face from the left.
+func parseOverlayAnchor(raw string) (*overlayAnchor, error) {
+	if !strings.HasPrefix(raw, "@face") {
+		return nil, fmt.Errorf("unknown anchor %s", raw)
+	}
+	idx, err := strconv.Atoi(strings.TrimPrefix(raw, "@face"))
+	if err != nil || idx < 0 {
+		return nil, fmt.Errorf("invalid face index %s", raw)
+	}
+	return &overlayAnchor{face: idx}, nil
+}
+
+// parseOverlayTiming parses a range of seconds e.g. 0.5-2
+func parseOverlayTiming(raw string) (*overlayTiming, error) {
+	startEnd := strings.SplitN(raw, "-", 2)
+	if len(startEnd) != 2 {
+		return nil, fmt.Errorf("timing should be in the format start-end: %s", raw)
+	}
+	start, err := strconv.ParseFloat(startEnd[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse start %s: %w", startEnd[0], err)
+	}
+	end, err := strconv.ParseFloat(startEnd[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse end %s: %w", startEnd[1], err)
+	}
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("end must be after start: %s", raw)
+	}
+	return &overlayTiming{
+		start: time.Duration(start * float64(time.Second)),
+		end:   time.Duration(end * float64(time.Second)),
+	}, nil
+}
+
+type overlayCell struct {
+	x, y float64
+}
+
+type overlayAnchor struct {
+	face int
+}
+
+type overlayTiming struct {
+	start, end time.Duration
+}
+
 type overlay struct {
 	name  string
 	x, y  float64
 	scale float64
 	hflip bool
+	// rotate is the clockwise rotation in degrees.
+	rotate float64
+	// opacity is between 0 (invisible) and 1 (opaque).
+	opacity  float64
+	animated bool
+	// hash is the overlay file's content hash.
+	hash string
+	// anchor is set if the position should be found by detecting a feature in the first frame.
+	anchor *overlayAnchor
+	// moveTo is set if the overlay should move from x, y to a different cell during the clip.
+	moveTo *overlayCell
+	// timing limits when the overlay is visible. Movement happens over the same period.
+	timing *overlayTiming
+}
+
+// cellExpressions returns the X and Y grid cell as ffmpeg expressions. If the overlay moves the cell
+// is interpolated over the overlay's timing (or the whole clip).
+func (o overlay) cellExpressions(clipDuration time.Duration) (string, string) {
+	if o.moveTo == nil {
+		return fmt.Sprintf("%0.2f", o.x), fmt.Sprintf("%0.2f", o.y)
+	}
+	start, end := time.Duration(0), clipDuration
+	if o.timing != nil {
+		start, end = o.timing.start, o.timing.end
+	}
+	progress := fmt.Sprintf(
+		"clip((t-%0.2f)/%0.2f,0,1)",
+		start.Seconds(),
+		max(end-start, time.Millisecond*10).Seconds(),
+	)
+	return fmt.Sprintf("(%0.2f+(%0.2f*%s))", o.x, o.moveTo.x-o.x, progress),
+		fmt.Sprintf("(%0.2f+(%0.2f*%s))", o.y, o.moveTo.y-o.y, progress)
+}
+
+func (o overlay) enableExpression() string {
+	if o.timing == nil {
+		return ""
+	}
+	return fmt.Sprintf(":enable='between(t,%0.2f,%0.2f)'", o.timing.start.Seconds(), o.timing.end.Seconds())
 }
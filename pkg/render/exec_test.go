@@ -0,0 +1,53 @@
+package render
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/warmans/tvgif/pkg/discord/media"
+	"github.com/warmans/tvgif/pkg/mediacache"
+	"github.com/warmans/tvgif/pkg/model"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// shrinkingExecutor outputs a smaller file each time it is called.
+type shrinkingExecutor struct {
+	calls int
+}
+
+func (e *shrinkingExecutor) Execute(ctx context.Context, cmd Command, writer io.Writer) error {
+	e.calls++
+	_, err := io.WriteString(writer, strings.Repeat("x", 100/e.calls))
+	return err
+}
+
+func TestExecRenderer_RenderFileProfile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	storage, err := mediacache.NewFilesystemStorage(t.TempDir(), logger)
+	require.NoError(t, err)
+	cache, err := mediacache.NewCache(storage, logger)
+	require.NoError(t, err)
+
+	executor := &shrinkingExecutor{}
+	renderer := NewExecRenderer(cache, logger, nil, executor)
+
+	customID := &media.ID{Publication: "peepshow", Series: 1, Episode: 2, StartPosition: 10}
+	dialog := []model.Dialog{{Pos: 10, StartTimestamp: time.Second, EndTimestamp: time.Second * 2, Content: "Hello"}}
+	opts := []Option{WithStartTimestamp(time.Second), WithEndTimestamp(time.Second * 2), WithSizeBudget(60)}
+
+	result, err := renderer.RenderFile("peepshow-S01E02.webm", customID, dialog, opts...)
+	require.NoError(t, err)
+	require.Equal(t, 2, executor.calls)
+	require.NotNil(t, result.Profile)
+	require.Equal(t, encodingProfiles[1], *result.Profile)
+
+	// the reduced profile should still be reported when the file comes from the cache.
+	result, err = renderer.RenderFile("peepshow-S01E02.webm", customID, dialog, opts...)
+	require.NoError(t, err)
+	require.Equal(t, 2, executor.calls)
+	require.NotNil(t, result.Profile)
+	require.Equal(t, encodingProfiles[1], *result.Profile)
+}
@@ -0,0 +1,190 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxRemoteExecutionTime is the longest a single command may run on a render worker.
+const maxRemoteExecutionTime = time.Minute
+
+// ErrWorkerUnavailable is returned if a render worker could not be reached or is unable to accept work.
+// Other errors mean the command itself failed so there is no point retrying it elsewhere.
+var ErrWorkerUnavailable = errors.New("render worker unavailable")
+
+// Executor runs ffmpeg commands, writing the command's stdout to the writer.
+type Executor interface {
+	Execute(ctx context.Context, cmd Command, writer io.Writer) error
+}
+
+func NewLocalExecutor(mediaPath string, logger *slog.Logger) *LocalExecutor {
+	return &LocalExecutor{mediaPath: mediaPath, logger: logger}
+}
+
+// LocalExecutor runs ffmpeg on the local host.
+type LocalExecutor struct {
+	mediaPath string
+	logger    *slog.Logger
+}
+
+// Healthy checks that ffmpeg is installed and the media dir is readable.
+func (e *LocalExecutor) Healthy() error {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("ffmpeg not found: %w", err)
+	}
+	if _, err := os.ReadDir(e.mediaPath); err != nil {
+		return fmt.Errorf("media dir is not readable: %w", err)
+	}
+	return nil
+}
+
+func (e *LocalExecutor) Execute(ctx context.Context, cmd Command, writer io.Writer) error {
+	args := cmd.Args(e.mediaPath)
+
+	e.logger.Info("Compiled command", slog.String("cmd", strings.Join(args, " ")))
+
+	proc := exec.CommandContext(ctx, "ffmpeg", args...)
+	proc.Stdout = writer
+	proc.Stderr = os.Stderr
+
+	return proc.Run()
+}
+
+func NewHTTPExecutor(workerURL string, token string, client *http.Client) *HTTPExecutor {
+	return &HTTPExecutor{workerURL: strings.TrimSuffix(workerURL, "/"), token: token, client: client}
+}
+
+// HTTPExecutor sends commands to a remote render worker (see NewExecutorHandler).
+type HTTPExecutor struct {
+	workerURL string
+	token     string
+	client    *http.Client
+}
+
+func (e *HTTPExecutor) Execute(ctx context.Context, cmd Command, writer io.Writer) error {
+	body, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to encode command: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.workerURL+"/v1/execute", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.token)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWorkerUnavailable, err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("render worker returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		if resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable {
+			return fmt.Errorf("%w: %s", ErrWorkerUnavailable, err.Error())
+		}
+		return err
+	}
+	if _, err := io.Copy(writer, resp.Body); err != nil {
+		return fmt.Errorf("%w: failed to read response: %s", ErrWorkerUnavailable, err.Error())
+	}
+	return nil
+}
+
+// Healthy checks the worker's health endpoint.
+func (e *HTTPExecutor) Healthy(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.workerURL+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("worker is unhealthy (%s): %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// NewWorkerHandler creates the full render worker API: the executor endpoint plus a health check.
+func NewWorkerHandler(executor Executor, healthCheck func() error, token string, logger *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/execute", NewExecutorHandler(executor, token, logger))
+	mux.HandleFunc("/healthz", func(resp http.ResponseWriter, req *http.Request) {
+		if err := healthCheck(); err != nil {
+			http.Error(resp, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = resp.Write([]byte("ok"))
+	})
+	return mux
+}
+
+// NewExecutorHandler exposes an executor over HTTP for use by a HTTPExecutor. Requests must include the
+// shared token as a bearer token.
+func NewExecutorHandler(executor Executor, token string, logger *slog.Logger) http.Handler {
+	return &executorHandler{executor: executor, token: token, logger: logger}
+}
+
+type executorHandler struct {
+	executor Executor
+	token    string
+	logger   *slog.Logger
+}
+
+func (h *executorHandler) authorized(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && h.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+func (h *executorHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(req) {
+		http.Error(resp, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	cmd := Command{}
+	if err := json.NewDecoder(req.Body).Decode(&cmd); err != nil {
+		http.Error(resp, fmt.Sprintf("invalid command: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err := validateCommand(cmd); err != nil {
+		h.logger.Warn("Rejected command", slog.String("err", err.Error()))
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), maxRemoteExecutionTime)
+	defer cancel()
+
+	// the output is buffered so a failure can still be reported with an error status.
+	buff := &bytes.Buffer{}
+	if err := h.executor.Execute(ctx, cmd, buff); err != nil {
+		h.logger.Error("Command failed", slog.String("err", err.Error()))
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := io.Copy(resp, buff); err != nil {
+		h.logger.Error("Failed to write response", slog.String("err", err.Error()))
+	}
+}
@@ -0,0 +1,131 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testWorkerToken = "secret"
+
+type fakeExecutor struct {
+	received *Command
+	output   []byte
+	err      error
+}
+
+func (f *fakeExecutor) Execute(ctx context.Context, cmd Command, writer io.Writer) error {
+	f.received = &cmd
+	if f.err != nil {
+		return f.err
+	}
+	_, err := writer.Write(f.output)
+	return err
+}
+
+func TestHTTPExecutor_Execute(t *testing.T) {
+	cmd := Command{
+		Inputs:      []Input{{Args: []string{"-ss", "1.00"}, Path: "peepshow-S01E02.webm"}},
+		FilterGraph: "[0:v]null",
+		OutputArgs:  []string{"-f", "webp"},
+	}
+	tests := []struct {
+		name       string
+		cmd        Command
+		token      string
+		executor   *fakeExecutor
+		wantOutput string
+		wantCmd    *Command
+		wantErr    require.ErrorAssertionFunc
+	}{
+		{
+			name:       "command is executed remotely",
+			cmd:        cmd,
+			executor:   &fakeExecutor{output: []byte("rendered")},
+			wantOutput: "rendered",
+			wantCmd:    &cmd,
+			wantErr:    require.NoError,
+		},
+		{
+			name:     "remote failure is returned",
+			cmd:      cmd,
+			executor: &fakeExecutor{err: errors.New("ffmpeg exploded")},
+			wantCmd:  &cmd,
+			wantErr: func(t require.TestingT, err error, i ...interface{}) {
+				require.ErrorContains(t, err, "ffmpeg exploded")
+			},
+		},
+		{
+			name:     "inputs outside the media dir are rejected",
+			cmd:      Command{Inputs: []Input{{Path: "../../etc/passwd"}}},
+			executor: &fakeExecutor{},
+			wantErr: func(t require.TestingT, err error, i ...interface{}) {
+				require.ErrorContains(t, err, "400 Bad Request")
+			},
+		},
+		{
+			name:     "wrong token is rejected",
+			cmd:      cmd,
+			token:    "wrong",
+			executor: &fakeExecutor{},
+			wantErr: func(t require.TestingT, err error, i ...interface{}) {
+				require.ErrorContains(t, err, "401 Unauthorized")
+			},
+		},
+		{
+			name:     "additional outputs are rejected",
+			cmd:      Command{Inputs: cmd.Inputs, OutputArgs: []string{"-f", "webp", "/tmp/evil.webp"}},
+			executor: &fakeExecutor{},
+			wantErr: func(t require.TestingT, err error, i ...interface{}) {
+				require.ErrorContains(t, err, "400 Bad Request")
+			},
+		},
+		{
+			name:     "file sources are rejected",
+			cmd:      Command{Inputs: cmd.Inputs, FilterGraph: "movie=/etc/passwd[m];[0:v][m]overlay"},
+			executor: &fakeExecutor{},
+			wantErr: func(t require.TestingT, err error, i ...interface{}) {
+				require.ErrorContains(t, err, "400 Bad Request")
+			},
+		},
+		{
+			name:     "file options are rejected",
+			cmd:      Command{Inputs: cmd.Inputs, FilterGraph: "[0:v]drawtext=textfile=/etc/passwd"},
+			executor: &fakeExecutor{},
+			wantErr: func(t require.TestingT, err error, i ...interface{}) {
+				require.ErrorContains(t, err, "400 Bad Request")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(NewExecutorHandler(tt.executor, testWorkerToken, slog.New(slog.NewTextHandler(io.Discard, nil))))
+			defer srv.Close()
+
+			token := testWorkerToken
+			if tt.token != "" {
+				token = tt.token
+			}
+			out := &bytes.Buffer{}
+			tt.wantErr(t, NewHTTPExecutor(srv.URL, token, srv.Client()).Execute(context.Background(), tt.cmd, out))
+			require.Equal(t, tt.wantOutput, out.String())
+			require.Equal(t, tt.wantCmd, tt.executor.received)
+		})
+	}
+}
+
+func TestExecutorHandler_MethodNotAllowed(t *testing.T) {
+	srv := httptest.NewServer(NewExecutorHandler(&fakeExecutor{}, testWorkerToken, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
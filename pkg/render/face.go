@@ -0,0 +1,142 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	pigo "github.com/esimov/pigo/core"
+	"image"
+	_ "image/png"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// facefinder is the pigo face detection cascade (https://github.com/esimov/pigo/tree/master/cascade).
+//
+//go:embed cascade/facefinder
+var faceFinderCascade []byte
+
+// minFaceQuality is the minimum detection score for a face to be used.
+const minFaceQuality = 5.0
+
+var faceClassifier *pigo.Pigo
+var faceClassifierOnce sync.Once
+var faceClassifierErr error
+
+type face struct {
+	// x, y is the center of the face in pixels
+	x, y float64
+	size float64
+}
+
+// detectFaces returns faces in the given image ordered from left to right.
+func detectFaces(img image.Image) ([]face, error) {
+	faceClassifierOnce.Do(func() {
+		faceClassifier, faceClassifierErr = pigo.NewPigo().Unpack(faceFinderCascade)
+	})
+	if faceClassifierErr != nil {
+		return nil, fmt.Errorf("failed to load face classifier: %w", faceClassifierErr)
+	}
+
+	cols, rows := img.Bounds().Dx(), img.Bounds().Dy()
+	params := pigo.CascadeParams{
+		MinSize:     20,
+		MaxSize:     max(cols, rows),
+		ShiftFactor: 0.1,
+		ScaleFactor: 1.1,
+		ImageParams: pigo.ImageParams{
+			Pixels: pigo.RgbToGrayscale(img),
+			Rows:   rows,
+			Cols:   cols,
+			Dim:    cols,
+		},
+	}
+
+	faces := []face{}
+	for _, det := range faceClassifier.ClusterDetections(faceClassifier.RunCascade(params, 0), 0.2) {
+		if det.Q < minFaceQuality {
+			continue
+		}
+		faces = append(faces, face{x: float64(det.Col), y: float64(det.Row), size: float64(det.Scale)})
+	}
+	sort.Slice(faces, func(i, j int) bool {
+		return faces[i].x < faces[j].x
+	})
+	return faces, nil
+}
+
+// extractFrame gets a single frame from the video at the given timestamp.
+func (r *ExecRenderer) extractFrame(videoFileName string, ts time.Duration) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	cmd := Command{
+		Inputs: []Input{{
+			Args: []string{"-ss", fmt.Sprintf("%0.2f", ts.Seconds())},
+			Path: videoFileName,
+		}},
+		OutputArgs: []string{
+			"-frames:v", "1",
+			"-f", "image2pipe",
+			"-c:v", "png",
+		},
+	}
+
+	out := &bytes.Buffer{}
+	if err := r.executor.Execute(ctx, cmd, out); err != nil {
+		return nil, fmt.Errorf("frame extract failed: %w", err)
+	}
+	img, _, err := image.Decode(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame: %w", err)
+	}
+	return img, nil
+}
+
+// resolveAnchors moves any anchored overlays to the position of the anchor in the first frame of the clip.
+// If the anchor cannot be found the overlay remains at its fallback grid position.
+func (r *ExecRenderer) resolveAnchors(videoFileName string, opts *renderOpts, overlays []overlay) []overlay {
+	anchored := false
+	for _, ov := range overlays {
+		if ov.anchor != nil {
+			anchored = true
+		}
+	}
+	if !anchored {
+		return overlays
+	}
+
+	logger := r.logger.With(slog.String("source", videoFileName))
+
+	frame, err := r.extractFrame(videoFileName, opts.startTimestamp)
+	if err != nil {
+		logger.Error("Failed to extract frame for anchors", slog.String("err", err.Error()))
+		return overlays
+	}
+	faces, err := detectFaces(frame)
+	if err != nil {
+		logger.Error("Failed to detect faces", slog.String("err", err.Error()))
+		return overlays
+	}
+	logger.Debug("Detected faces", slog.Int("num", len(faces)))
+
+	cellWidth := float64(frame.Bounds().Dx()) / overlayGridSizeX
+	cellHeight := float64(frame.Bounds().Dy()) / overlayGridSizeY
+
+	for k, ov := range overlays {
+		if ov.anchor == nil {
+			continue
+		}
+		if ov.anchor.face >= len(faces) {
+			logger.Warn("Anchor not found, using fallback position", slog.Int("face", ov.anchor.face))
+			continue
+		}
+		// the overlay filter centers the image in the given cell, so remove half a cell.
+		overlays[k].x = (faces[ov.anchor.face].x / cellWidth) - 0.5
+		overlays[k].y = (faces[ov.anchor.face].y / cellHeight) - 0.5
+	}
+	return overlays
+}
@@ -1,16 +1,10 @@
 package render
 
 import (
-	"bytes"
 	"fmt"
-	"github.com/bwmarrin/discordgo"
-	ffmpeg_go "github.com/u2takey/ffmpeg-go"
 	"github.com/warmans/tvgif/pkg/discord/media"
-	"github.com/warmans/tvgif/pkg/mediacache"
 	model2 "github.com/warmans/tvgif/pkg/model"
-	"io"
-	"os"
-	"path"
+	"github.com/warmans/tvgif/pkg/util"
 	"strings"
 	"time"
 )
@@ -21,8 +15,14 @@ const (
 	OutputWebp OutputFileType = "webp"
 	OutputWebm OutputFileType = "webm"
 	OutputGif  OutputFileType = "gif"
+	OutputPng  OutputFileType = "png"
+	OutputJpeg OutputFileType = "jpeg"
 )
 
+func isStillOutput(tp OutputFileType) bool {
+	return tp == OutputPng || tp == OutputJpeg
+}
+
 type SpecialMode string
 
 const (
@@ -31,6 +31,87 @@ const (
 	CaptionMode SpecialMode = "caption"
 )
 
+// EncodingProfile controls the output quality/size trade-off. Zero FPS means the source frame rate is kept.
+type EncodingProfile struct {
+	FPS     int
+	Scale   float64
+	Quality int
+}
+
+func (p EncodingProfile) String() string {
+	fps := "source fps"
+	if p.FPS > 0 {
+		fps = fmt.Sprintf("%dfps", p.FPS)
+	}
+	return fmt.Sprintf("%s %d%% q%d", fps, int(p.Scale*100), p.Quality)
+}
+
+var defaultEncodingProfile = EncodingProfile{FPS: 0, Scale: 1, Quality: 90}
+
+// encodingProfiles are tried in order until the output fits within the size budget.
+var encodingProfiles = []EncodingProfile{
+	defaultEncodingProfile,
+	{FPS: 10, Scale: 1, Quality: 75},
+	{FPS: 8, Scale: 0.8, Quality: 60},
+	{FPS: 6, Scale: 0.6, Quality: 50},
+	{FPS: 5, Scale: 0.5, Quality: 40},
+}
+
+type CompositionLayout string
+
+const (
+	CompositionSequence CompositionLayout = "sequence"
+	CompositionHStack   CompositionLayout = "hstack"
+	CompositionVStack   CompositionLayout = "vstack"
+)
+
+// compositionWidth/Height is the size each clip is normalised to before being combined.
+const compositionWidth = 596
+const compositionHeight = 336
+
+// Clip is an additional section of video to be composed with the main clip.
+type Clip struct {
+	VideoFileName  string
+	Publication    string
+	Dialog         []model2.Dialog
+	StartTimestamp time.Duration
+	EndTimestamp   time.Duration
+}
+
+type compositionOpts struct {
+	layout CompositionLayout
+	clips  []Clip
+}
+
+type TextPosition string
+
+const (
+	TextTop    TextPosition = "top"
+	TextBottom TextPosition = "bottom"
+	TextCenter TextPosition = "center"
+	// TextCustom uses the X and Y of the TextBlock.
+	TextCustom TextPosition = "custom"
+)
+
+// TextBlock is a styled piece of text drawn over the video e.g. top/bottom meme text.
+type TextBlock struct {
+	Text     string
+	Position TextPosition
+	X, Y     int
+	// Colour is any colour understood by ffmpeg e.g. white or #ff0000
+	Colour string
+	Size   int
+	// Start and End limit when the text is visible. If End is zero the text is shown for the whole clip.
+	Start, End time.Duration
+}
+
+// contactSheetOpts controls the grid of frames rendered instead of the clip.
+type contactSheetOpts struct {
+	columns, rows int
+	// padding extends the range either side of the clip so the user can see what would be added by extending it.
+	padding time.Duration
+}
+
 type StickerModeOpts struct {
 	X           int32 `json:"x,omitempty"`
 	Y           int32 `json:"y,omitempty"`
@@ -45,6 +126,9 @@ func resolveRenderOpts(opt ...Option) *renderOpts {
 	for _, v := range opt {
 		v(opts)
 	}
+	if opts.contactSheet != nil {
+		opts.outputFileType = OutputJpeg
+	}
 
 	return opts
 }
@@ -53,7 +137,6 @@ type renderOpts struct {
 	startTimestamp  time.Duration
 	endTimestamp    time.Duration
 	outputFileType  OutputFileType
-	disableCaching  bool
 	customText      []string
 	caption         string
 	disableSubs     bool
@@ -61,6 +144,25 @@ type renderOpts struct {
 	stickerModeOpts *StickerModeOpts
 	overlayConfig   overlayConfig
 	showGrid        bool
+	sizeBudget      int64
+	speed           float64
+	reverse         bool
+	boomerang       bool
+	frameOffset     *time.Duration
+	composition     compositionOpts
+	textBlocks      []TextBlock
+	contactSheet    *contactSheetOpts
+}
+
+// resolveFrameOffset gets the position of the frame to use for still images relative to the start of the clip.
+// If no offset was given the middle frame is used.
+func (o *renderOpts) resolveFrameOffset() time.Duration {
+	duration := o.endTimestamp - o.startTimestamp
+	if o.frameOffset == nil {
+		return duration / 2
+	}
+	// seeking to the very end of the clip would not output any frames.
+	return max(min(*o.frameOffset, duration-(time.Millisecond*100)), 0)
 }
 
 func WithOutputFileType(tp OutputFileType) Option {
@@ -81,12 +183,6 @@ func WithEndTimestamp(ts time.Duration) Option {
 	}
 }
 
-func WithCaching(disabled bool) Option {
-	return func(opts *renderOpts) {
-		opts.disableCaching = disabled
-	}
-}
-
 func WithCustomText(text []string) Option {
 	return func(opts *renderOpts) {
 		opts.customText = text
@@ -142,6 +238,66 @@ func WithGrid(enable bool) Option {
 	}
 }
 
+// WithSpeed changes the playback speed e.g. 0.5 for slow motion or 2 for double speed.
+func WithSpeed(speed float64) Option {
+	return func(opts *renderOpts) {
+		if speed <= 0 {
+			return
+		}
+		opts.speed = speed
+	}
+}
+
+func WithReverse(enable bool) Option {
+	return func(opts *renderOpts) {
+		opts.reverse = enable
+	}
+}
+
+// WithBoomerang plays the clip forward then backwards so it loops seamlessly.
+func WithBoomerang(enable bool) Option {
+	return func(opts *renderOpts) {
+		opts.boomerang = enable
+	}
+}
+
+// WithFrameOffset sets the offset from the start timestamp used when rendering a still image.
+func WithFrameOffset(offset *time.Duration) Option {
+	return func(opts *renderOpts) {
+		opts.frameOffset = offset
+	}
+}
+
+// WithTextBlocks draws each of the blocks over the final frame.
+func WithTextBlocks(blocks []TextBlock) Option {
+	return func(opts *renderOpts) {
+		opts.textBlocks = blocks
+	}
+}
+
+// WithComposition combines the main clip with the given clips either one after the other or stacked.
+func WithComposition(layout CompositionLayout, clips []Clip) Option {
+	return func(opts *renderOpts) {
+		opts.composition = compositionOpts{layout: layout, clips: clips}
+	}
+}
+
+// WithContactSheet renders a single JPEG of columns*rows evenly spaced frames from the clip (plus the padding
+// either side) with the time relative to the start of the clip drawn on each frame.
+func WithContactSheet(columns int, rows int, padding time.Duration) Option {
+	return func(opts *renderOpts) {
+		opts.contactSheet = &contactSheetOpts{columns: max(columns, 1), rows: max(rows, 1), padding: padding}
+	}
+}
+
+// WithSizeBudget will cause the output to be re-rendered at progressively lower quality until
+// it is smaller than the given number of bytes.
+func WithSizeBudget(maxBytes int64) Option {
+	return func(opts *renderOpts) {
+		opts.sizeBudget = maxBytes
+	}
+}
+
 type Option func(opts *renderOpts)
 
 type drawTextOpts struct {
@@ -162,125 +318,12 @@ func withSimpsonsFont(enable bool) drawTextOpt {
 	}
 }
 
-func NewRenderer(cache *mediacache.Cache, mediaPath string) *FfmpegRenderer {
-	return &FfmpegRenderer{mediaCache: cache, mediaPath: mediaPath}
-}
-
-type FfmpegRenderer struct {
-	mediaCache *mediacache.Cache
-	mediaPath  string
-}
-
-func (r *FfmpegRenderer) RenderFile(
-	videoFileName string,
-	customID *media.ID,
-	dialog []model2.Dialog,
-	opt ...Option,
-) (*discordgo.File, error) {
-
-	opts := resolveRenderOpts(opt...)
-
-	var mimeType string
-	var extension string
-	buff := &bytes.Buffer{}
-
-	var err error
-	switch opts.outputFileType {
-	case OutputWebm:
-		mimeType = "video/webm"
-		extension = "webm"
-		_, err = r.mediaCache.Get(createFileName(customID, extension), buff, opts.disableCaching, func(writer io.Writer) error {
-			err := ffmpeg_go.
-				Input(path.Join(r.mediaPath, videoFileName),
-					ffmpeg_go.KwArgs{
-						"ss": fmt.Sprintf("%0.2f", opts.startTimestamp.Seconds()),
-					}).
-				Output("pipe:",
-					ffmpeg_go.KwArgs{
-						"t":            fmt.Sprintf("%0.2f", opts.endTimestamp.Seconds()-opts.startTimestamp.Seconds()),
-						"map_metadata": "-1",
-						"format":       "webm",
-						"filter_complex": joinFilters(
-							"0:v",
-							onlyIf(
-								!opts.disableSubs,
-								createDrawtextFilter(
-									dialog,
-									opts,
-									withSimpsonsFont(customID.Publication == "simpsons"),
-								),
-							),
-						),
-					},
-				).WithOutput(writer, os.Stderr).Run()
-			if err != nil {
-				return fmt.Errorf("ffmpeg command failed: %w", err)
-			}
-			return nil
-		})
-	case OutputGif, OutputWebp:
-		mimeType = "image/gif"
-		extension = "gif"
-		format := "gif"
-		if opts.outputFileType == OutputWebp {
-			mimeType = "image/webp"
-			extension = "webp"
-			format = "webp"
-		}
-		_, err = r.mediaCache.Get(createFileName(customID, extension), buff, opts.disableCaching, func(writer io.Writer) error {
-			err := ffmpeg_go.
-				Input(path.Join(r.mediaPath, videoFileName),
-					ffmpeg_go.KwArgs{
-						"ss": fmt.Sprintf("%0.2f", opts.startTimestamp.Seconds()),
-						"to": fmt.Sprintf("%0.2f", opts.endTimestamp.Seconds()),
-					}).
-				Output("pipe:",
-					ffmpeg_go.KwArgs{
-						"format": format,
-						"filter_complex": joinFilters(
-							"0:v",
-							onlyIf(
-								!opts.disableSubs,
-								createDrawtextFilter(
-									dialog,
-									opts,
-									withSimpsonsFont(customID.Publication == "simpsons"),
-								),
-							),
-							createStickerCropFilter(opts),
-							createStickerResizeFilter(opts),
-							createCaptionScaleFilter(opts),
-							createDrawtextCaptionFilter(opts.caption),
-						),
-						// for some reason this is necessary for discord to display webp images.
-						// it doesn't actually stop it from looping or affect gifs...
-						"loop":    "0",
-						"quality": "90",
-					},
-				).WithOutput(writer, os.Stderr).Run()
-			if err != nil {
-				return fmt.Errorf("ffmpeg failed: %w", err)
-			}
-
-			return nil
-		})
-	}
-	if err != nil {
-		return nil, fmt.Errorf("cache fetch failed: %w", err)
-	}
-	return &discordgo.File{
-		Name:        createFileName(customID, extension),
-		ContentType: mimeType,
-		Reader:      buff,
-	}, nil
-}
-
 func createDrawtextFilter(dialog []model2.Dialog, renderOpts *renderOpts, opts ...drawTextOpt) string {
 	options := &drawTextOpts{boxOpacity: 0.5, fontSize: 18}
 	for _, v := range opts {
 		v(options)
 	}
-	if renderOpts.specialMode == StickerMode {
+	if renderOpts.specialMode == StickerMode || len(dialog) == 0 {
 		return ""
 	}
 	drawTextCommands := []string{}
@@ -338,6 +381,51 @@ func createDrawtextCaptionFilter(caption string) string {
 	return strings.Join(drawTextCommands, ", ")
 }
 
+func createDrawtextBlocksFilter(blocks []TextBlock) string {
+	drawTextCommands := []string{}
+	for _, block := range blocks {
+		if strings.TrimSpace(block.Text) == "" {
+			continue
+		}
+		size := util.IfElse(block.Size > 0, block.Size, 24)
+		colour := util.IfElse(block.Colour != "", block.Colour, "white")
+		lineHeight := size + 10
+
+		// reduce the line length as the text gets bigger to keep it inside the frame
+		lines := strings.Split(formatGifText(max(56*18/size, 8), strings.Split(block.Text, "\n")), "\n")
+
+		enable := ""
+		if block.End > 0 {
+			enable = fmt.Sprintf(":enable='between(t,%0.2f,%0.2f)'", block.Start.Seconds(), block.End.Seconds())
+		}
+		for k, line := range lines {
+			x := "(w-text_w)/2"
+			y := ""
+			switch block.Position {
+			case TextBottom:
+				y = fmt.Sprintf("h-10-%d", (len(lines)-k)*lineHeight)
+			case TextCenter:
+				y = fmt.Sprintf("((h-%d)/2)+%d", len(lines)*lineHeight, k*lineHeight)
+			case TextCustom:
+				x = fmt.Sprintf("%d", block.X)
+				y = fmt.Sprintf("%d", block.Y+(k*lineHeight))
+			default:
+				y = fmt.Sprintf("%d", 10+(k*lineHeight))
+			}
+			drawTextCommands = append(drawTextCommands, fmt.Sprintf(
+				`drawtext=text='%s':expansion=none:fontcolor=%s:fontsize=%d:borderw=2:bordercolor=black:x=%s:y=%s%s`,
+				line,
+				colour,
+				size,
+				x,
+				y,
+				enable,
+			))
+		}
+	}
+	return strings.Join(drawTextCommands, ", ")
+}
+
 func createStickerCropFilter(opts *renderOpts) string {
 	if opts.specialMode != StickerMode || opts.stickerModeOpts == nil {
 		return ""
@@ -366,6 +454,91 @@ func createCaptionScaleFilter(opts *renderOpts) string {
 	return "scale=421:238:force_original_aspect_ratio=decrease,pad=596:336:(ow-iw)/2:(oh-ih)/2+30,setsar=1"
 }
 
+// createCompositionFilter draws the subtitles onto each input clip separately then combines them into a single
+// stream labeled [comp]. The main clip is expected to be input 0 followed by the composition clips.
+func createCompositionFilter(customID *media.ID, dialog []model2.Dialog, opts *renderOpts) string {
+	if len(opts.composition.clips) == 0 {
+		return ""
+	}
+	clips := append([]Clip{{Publication: customID.Publication, Dialog: dialog}}, opts.composition.clips...)
+
+	normaliseFilter := fmt.Sprintf(
+		"scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1",
+		compositionWidth,
+		compositionHeight,
+		compositionWidth,
+		compositionHeight,
+	)
+
+	filter := ""
+	labels := ""
+	for k, clip := range clips {
+		clipOpts := *opts
+		if k > 0 {
+			// custom text only applies to the main clip
+			clipOpts.customText = nil
+		}
+		filter += fmt.Sprintf(
+			"[%d:v]%s[c%d];",
+			k,
+			strings.Join(dropEmptyFilters([]string{
+				normaliseFilter,
+				onlyIf(!opts.disableSubs, createDrawtextFilter(clip.Dialog, &clipOpts, withSimpsonsFont(clip.Publication == "simpsons"))),
+			}), ","),
+			k,
+		)
+		labels += fmt.Sprintf("[c%d]", k)
+	}
+
+	switch opts.composition.layout {
+	case CompositionHStack:
+		filter += fmt.Sprintf("%shstack=inputs=%d,scale=w='min(iw,%d)':h=-2[comp];", labels, len(clips), compositionWidth*2)
+	case CompositionVStack:
+		filter += fmt.Sprintf("%svstack=inputs=%d,scale=w=-2:h='min(ih,%d)'[comp];", labels, len(clips), compositionHeight*2)
+	default:
+		filter += fmt.Sprintf("%sconcat=n=%d:v=1[comp];", labels, len(clips))
+	}
+	return filter
+}
+
+// hasTimeEffect checks if the video's timing is changed by the speed, reverse or boomerang options.
+func hasTimeEffect(opts *renderOpts) bool {
+	return (opts.speed > 0 && opts.speed != 1) || opts.reverse || opts.boomerang
+}
+
+func createSpeedFilter(opts *renderOpts) string {
+	if opts.speed <= 0 || opts.speed == 1 {
+		return ""
+	}
+	return fmt.Sprintf("setpts=PTS/%0.2f", opts.speed)
+}
+
+func createReverseFilter(opts *renderOpts) string {
+	if !opts.reverse {
+		return ""
+	}
+	return "reverse"
+}
+
+func createBoomerangFilter(opts *renderOpts) string {
+	if !opts.boomerang {
+		return ""
+	}
+	// the output of concat is labeled by joinFilters so this can be used like any other filter in the chain.
+	return "split[bmf][bmr];[bmr]reverse[bmrr];[bmf][bmrr]concat=n=2:v=1"
+}
+
+func createProfileFilter(profile EncodingProfile) string {
+	filters := []string{}
+	if profile.FPS > 0 {
+		filters = append(filters, fmt.Sprintf("fps=%d", profile.FPS))
+	}
+	if profile.Scale > 0 && profile.Scale < 1 {
+		filters = append(filters, fmt.Sprintf("scale=w=iw*%0.2f:h=-2", profile.Scale))
+	}
+	return strings.Join(filters, ",")
+}
+
 func createGridFilter(xCells, yCells int) string {
 	return fmt.Sprintf("drawgrid=w=iw/%d:h=ih/%d:t=2:c=red@0.5", xCells, yCells)
 }
@@ -373,6 +546,10 @@ func createGridFilter(xCells, yCells int) string {
 func joinFilters(startAt string, filters ...string) string {
 	joined := ""
 	filters = dropEmptyFilters(filters)
+	if len(filters) == 0 {
+		// a label on its own is not a valid graph so pass the stream through unchanged.
+		filters = []string{"null"}
+	}
 	for k, v := range filters {
 		connector := ""
 		if k < len(filters)-1 {
@@ -393,7 +570,14 @@ func dropEmptyFilters(filters []string) []string {
 	return clean
 }
 
-func createFileName(customID *media.ID, suffix string) string {
+func createFileName(customID *media.ID, opts *renderOpts, suffix string) string {
+	if opts.contactSheet != nil {
+		return fmt.Sprintf("%s-sheet.%s", customID.DialogID(), suffix)
+	}
+	if isStillOutput(opts.outputFileType) {
+		// stills from the same dialog can be taken at any offset so this needs to be part of the key.
+		return fmt.Sprintf("%s-%d.%s", customID.DialogID(), opts.resolveFrameOffset().Milliseconds(), suffix)
+	}
 	return fmt.Sprintf("%s.%s", customID.DialogID(), suffix)
 }
 
@@ -0,0 +1,126 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const workerHealthCheckInterval = time.Second * 10
+
+func NewPoolExecutor(workerURLs []string, token string, client *http.Client, logger *slog.Logger) (*PoolExecutor, error) {
+	if len(workerURLs) == 0 {
+		return nil, fmt.Errorf("at least one worker URL is required")
+	}
+	pool := &PoolExecutor{logger: logger}
+	for _, u := range workerURLs {
+		w := &poolWorker{url: u, executor: NewHTTPExecutor(u, token, client)}
+		// workers are assumed to be healthy until a check says otherwise.
+		w.healthy.Store(true)
+		pool.workers = append(pool.workers, w)
+	}
+	return pool, nil
+}
+
+type poolWorker struct {
+	url      string
+	executor *HTTPExecutor
+	healthy  atomic.Bool
+}
+
+// PoolExecutor distributes commands between a number of render workers. Unhealthy workers are skipped and
+// a command will fail over to the next worker if the current one is unavailable.
+type PoolExecutor struct {
+	workers []*poolWorker
+	next    atomic.Uint64
+	logger  *slog.Logger
+}
+
+// Run periodically checks the health of all workers until the context is cancelled.
+func (p *PoolExecutor) Run(ctx context.Context) {
+	ticker := time.NewTicker(workerHealthCheckInterval)
+	defer ticker.Stop()
+
+	p.CheckHealth(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.CheckHealth(ctx)
+		}
+	}
+}
+
+// CheckHealth checks all workers concurrently and updates their status.
+func (p *PoolExecutor) CheckHealth(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	for _, w := range p.workers {
+		wg.Add(1)
+		go func(w *poolWorker) {
+			defer wg.Done()
+			err := w.executor.Healthy(ctx)
+			p.setHealthy(w, err)
+		}(w)
+	}
+	wg.Wait()
+}
+
+func (p *PoolExecutor) Execute(ctx context.Context, cmd Command, writer io.Writer) error {
+	var lastErr error
+	for _, w := range p.candidates() {
+		// buffer the output so a failed attempt doesn't leave partial output in the writer.
+		buff := &bytes.Buffer{}
+		err := w.executor.Execute(ctx, cmd, buff)
+		if err == nil {
+			_, err := io.Copy(writer, buff)
+			return err
+		}
+		if !errors.Is(err, ErrWorkerUnavailable) {
+			return err
+		}
+		p.setHealthy(w, err)
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return fmt.Errorf("all render workers failed: %w", lastErr)
+}
+
+// candidates gets workers in the order they should be tried. Healthy workers are used round-robin and
+// unhealthy workers are tried last in case their status is stale.
+func (p *PoolExecutor) candidates() []*poolWorker {
+	start := int(p.next.Add(1) % uint64(len(p.workers)))
+
+	healthy, unhealthy := []*poolWorker{}, []*poolWorker{}
+	for i := range p.workers {
+		w := p.workers[(start+i)%len(p.workers)]
+		if w.healthy.Load() {
+			healthy = append(healthy, w)
+		} else {
+			unhealthy = append(unhealthy, w)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (p *PoolExecutor) setHealthy(w *poolWorker, err error) {
+	wasHealthy := w.healthy.Swap(err == nil)
+	if err != nil && wasHealthy {
+		p.logger.Warn("Render worker is unhealthy", slog.String("url", w.url), slog.String("err", err.Error()))
+	}
+	if err == nil && !wasHealthy {
+		p.logger.Info("Render worker recovered", slog.String("url", w.url))
+	}
+}
@@ -0,0 +1,97 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPoolExecutor_Execute(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	healthy := func() error { return nil }
+
+	working := httptest.NewServer(NewWorkerHandler(&fakeExecutor{output: []byte("ok")}, healthy, testWorkerToken, logger))
+	defer working.Close()
+
+	failing := httptest.NewServer(NewWorkerHandler(&fakeExecutor{err: errors.New("bad filter")}, healthy, testWorkerToken, logger))
+	defer failing.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name       string
+		workerURLs []string
+		wantOutput string
+		wantErr    require.ErrorAssertionFunc
+	}{
+		{
+			name:       "single working worker",
+			workerURLs: []string{working.URL},
+			wantOutput: "ok",
+			wantErr:    require.NoError,
+		},
+		{
+			name:       "fails over from unavailable worker",
+			workerURLs: []string{down.URL, working.URL, down.URL},
+			wantOutput: "ok",
+			wantErr:    require.NoError,
+		},
+		{
+			name:       "all workers unavailable",
+			workerURLs: []string{down.URL, down.URL},
+			wantErr: func(t require.TestingT, err error, i ...interface{}) {
+				require.ErrorIs(t, err, ErrWorkerUnavailable)
+			},
+		},
+		{
+			name:       "command failures are not retried",
+			workerURLs: []string{failing.URL},
+			wantErr: func(t require.TestingT, err error, i ...interface{}) {
+				require.ErrorContains(t, err, "bad filter")
+				require.NotErrorIs(t, err, ErrWorkerUnavailable)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewPoolExecutor(tt.workerURLs, testWorkerToken, &http.Client{}, logger)
+			require.NoError(t, err)
+
+			// run several times to ensure the round-robin start position doesn't matter.
+			for i := 0; i < len(tt.workerURLs); i++ {
+				out := &bytes.Buffer{}
+				tt.wantErr(t, pool.Execute(context.Background(), Command{}, out))
+				require.Equal(t, tt.wantOutput, out.String())
+			}
+		})
+	}
+}
+
+func TestPoolExecutor_CheckHealth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	healthy := httptest.NewServer(NewWorkerHandler(&fakeExecutor{}, func() error { return nil }, testWorkerToken, logger))
+	defer healthy.Close()
+
+	unhealthy := httptest.NewServer(NewWorkerHandler(&fakeExecutor{}, func() error { return errors.New("no ffmpeg") }, testWorkerToken, logger))
+	defer unhealthy.Close()
+
+	pool, err := NewPoolExecutor([]string{unhealthy.URL, healthy.URL}, testWorkerToken, &http.Client{}, logger)
+	require.NoError(t, err)
+
+	pool.CheckHealth(context.Background())
+	require.False(t, pool.workers[0].healthy.Load())
+	require.True(t, pool.workers[1].healthy.Load())
+
+	// the unhealthy worker should always be tried last.
+	for i := 0; i < 3; i++ {
+		require.Equal(t, healthy.URL, pool.candidates()[0].url)
+	}
+}
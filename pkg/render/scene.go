@@ -0,0 +1,118 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sceneChangeThreshold is the minimum scene score (0-1) for a frame to be considered a cut.
+const sceneChangeThreshold = 0.3
+
+// maxCachedSceneCuts is the number of probe results to keep. Each preview of a snapped clip needs two.
+const maxCachedSceneCuts = 1000
+
+var ptsTimeRegex = regexp.MustCompile(`pts_time:([0-9.]+)`)
+
+type SceneCutDetector interface {
+	SceneCuts(videoFileName string, from time.Duration, to time.Duration) ([]time.Duration, error)
+}
+
+// sceneCutCache remembers the results of scene probes since they are needed before the render cache can be
+// checked i.e. every time a snapped clip is previewed or posted.
+type sceneCutCache struct {
+	lock sync.Mutex
+	cuts map[string][]time.Duration
+}
+
+func (c *sceneCutCache) get(key string) ([]time.Duration, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cuts, ok := c.cuts[key]
+	return cuts, ok
+}
+
+func (c *sceneCutCache) set(key string, cuts []time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cuts == nil || len(c.cuts) >= maxCachedSceneCuts {
+		// probes are cheap enough compared to a render that it's not worth tracking which were used most recently.
+		c.cuts = map[string][]time.Duration{}
+	}
+	c.cuts[key] = cuts
+}
+
+// SceneCuts returns the timestamps of the first frame of each new shot between from and to.
+func (r *ExecRenderer) SceneCuts(videoFileName string, from time.Duration, to time.Duration) ([]time.Duration, error) {
+	key := fmt.Sprintf("%s:%d:%d", videoFileName, from, to)
+	if cuts, ok := r.sceneCuts.get(key); ok {
+		return cuts, nil
+	}
+	cuts, err := r.probeSceneCuts(videoFileName, from, to)
+	if err != nil {
+		return nil, err
+	}
+	r.sceneCuts.set(key, cuts)
+	return cuts, nil
+}
+
+func (r *ExecRenderer) probeSceneCuts(videoFileName string, from time.Duration, to time.Duration) ([]time.Duration, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	// the null muxer discards the video so stdout will only contain the printed metadata.
+	cmd := Command{
+		Inputs: []Input{{
+			Args: []string{
+				"-ss", fmt.Sprintf("%0.2f", max(from, 0).Seconds()),
+				"-to", fmt.Sprintf("%0.2f", to.Seconds()),
+			},
+			Path: videoFileName,
+		}},
+		FilterGraph: fmt.Sprintf("[0:v]select='gt(scene,%0.2f)',metadata=print:file=-", sceneChangeThreshold),
+		OutputArgs:  []string{"-f", "null"},
+	}
+
+	out := &bytes.Buffer{}
+	if err := r.executor.Execute(ctx, cmd, out); err != nil {
+		return nil, fmt.Errorf("scene probe failed: %w", err)
+	}
+
+	return parseSceneCuts(out.String(), max(from, 0))
+}
+
+// parseSceneCuts extracts frame times from the output of ffmpeg's metadata=print filter.
+// Timestamps are relative to the seek position so must be offset by the start of the probed range.
+func parseSceneCuts(output string, offset time.Duration) ([]time.Duration, error) {
+	cuts := []time.Duration{}
+	for _, match := range ptsTimeRegex.FindAllStringSubmatch(output, -1) {
+		seconds, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pts_time %s: %w", match[1], err)
+		}
+		cuts = append(cuts, offset+time.Duration(seconds*float64(time.Second)))
+	}
+	return cuts, nil
+}
+
+// NearestCut finds the cut closest to the given timestamp that is no further than maxDistance from it.
+func NearestCut(cuts []time.Duration, ts time.Duration, maxDistance time.Duration) (time.Duration, bool) {
+	found := false
+	nearest := ts
+	for _, cut := range cuts {
+		distance := (cut - ts).Abs()
+		if distance > maxDistance {
+			continue
+		}
+		if !found || distance < (nearest-ts).Abs() {
+			nearest = cut
+			found = true
+		}
+	}
+	return nearest, found
+}
@@ -0,0 +1,112 @@
+package render
+
+import (
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestParseSceneCuts(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		offset  time.Duration
+		want    []time.Duration
+		wantErr bool
+	}{
+		{
+			name: "no cuts",
+			want: []time.Duration{},
+		},
+		{
+			name: "cuts are offset by the start of the range",
+			output: `frame:0    pts:1001    pts_time:0.5
+lavfi.scene_score=0.412
+frame:1    pts:3003    pts_time:1.25
+lavfi.scene_score=0.901
+`,
+			offset: time.Second * 10,
+			want:   []time.Duration{time.Millisecond * 10500, time.Millisecond * 11250},
+		},
+		{
+			name:    "invalid pts_time",
+			output:  "frame:0    pts:1001    pts_time:1.2.3",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSceneCuts(tt.output, tt.offset)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNearestCut(t *testing.T) {
+	tests := []struct {
+		name      string
+		cuts      []time.Duration
+		ts        time.Duration
+		want      time.Duration
+		wantFound bool
+	}{
+		{
+			name: "no cuts",
+			ts:   time.Second,
+			want: time.Second,
+		},
+		{
+			name: "all cuts too far away",
+			cuts: []time.Duration{time.Millisecond * 100, time.Millisecond * 3500},
+			ts:   time.Second * 2,
+			want: time.Second * 2,
+		},
+		{
+			name:      "closest cut is used",
+			cuts:      []time.Duration{time.Millisecond * 1500, time.Millisecond * 2100, time.Millisecond * 2800},
+			ts:        time.Second * 2,
+			want:      time.Millisecond * 2100,
+			wantFound: true,
+		},
+		{
+			name:      "cut exactly max distance away",
+			cuts:      []time.Duration{time.Second * 3},
+			ts:        time.Second * 2,
+			want:      time.Second * 3,
+			wantFound: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := NearestCut(tt.cuts, tt.ts, time.Second)
+			require.Equal(t, tt.wantFound, found)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExecRenderer_SceneCutsAreCached(t *testing.T) {
+	executor := &fakeExecutor{output: []byte("frame:0    pts:1001    pts_time:0.5")}
+	renderer := NewExecRenderer(nil, slog.Default(), nil, executor)
+
+	cuts, err := renderer.SceneCuts("peepshow-S01E02.webm", time.Second, time.Second*3)
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{time.Millisecond * 1500}, cuts)
+	require.NotNil(t, executor.received)
+
+	executor.received = nil
+	cuts, err = renderer.SceneCuts("peepshow-S01E02.webm", time.Second, time.Second*3)
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{time.Millisecond * 1500}, cuts)
+	require.Nil(t, executor.received, "expected cached result to be used")
+
+	_, err = renderer.SceneCuts("peepshow-S01E02.webm", time.Second*2, time.Second*4)
+	require.NoError(t, err)
+	require.NotNil(t, executor.received, "expected a different range to be probed")
+}
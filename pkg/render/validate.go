@@ -0,0 +1,272 @@
+package render
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// numericArg matches values like 1.25, -1 or 0.
+var numericArg = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// allowedInputArgs are the input options a worker will accept along with the allowed values (nil means numeric).
+var allowedInputArgs = map[string][]string{
+	"-ss":           nil,
+	"-to":           nil,
+	"-ignore_loop":  nil,
+	"-loop":         nil,
+	"-pattern_type": {"none"},
+	"-f":            {"image2"},
+}
+
+// allowedOutputArgs are the output options a worker will accept along with the allowed values (nil means numeric).
+var allowedOutputArgs = map[string][]string{
+	"-ss":           nil,
+	"-loop":         nil,
+	"-quality":      nil,
+	"-frames:v":     nil,
+	"-q:v":          nil,
+	"-map_metadata": nil,
+	"-f":            {string(OutputGif), string(OutputWebp), string(OutputWebm), "image2pipe", "null"},
+	"-c:v":          {"mjpeg", "png"},
+}
+
+// allowedOutputFlags are the output options a worker will accept that have no value.
+var allowedOutputFlags = []string{"-an"}
+
+// filterSpec describes the options a filter may be given.
+type filterSpec struct {
+	// positional is the number of options that may be given without a name e.g. scale=160:160
+	positional int
+	keys       []string
+}
+
+// allowedFilters are the filters the renderer creates. Anything else (e.g. movie or frei0r) could be used to
+// read or write files on the worker so is rejected.
+var allowedFilters = map[string]filterSpec{
+	"drawtext": {keys: []string{
+		"fontfile", "text", "line_spacing", "expansion", "fontcolor", "fontsize", "box", "boxcolor", "boxborderw",
+		"borderw", "bordercolor", "shadowx", "shadowy", "x", "y", "enable",
+	}},
+	"scale":             {positional: 2, keys: []string{"w", "h", "force_original_aspect_ratio"}},
+	"crop":              {keys: []string{"w", "h", "x", "y"}},
+	"pad":               {positional: 4},
+	"setsar":            {positional: 1},
+	"hflip":             {},
+	"rotate":            {keys: []string{"a", "c", "ow", "oh"}},
+	"format":            {positional: 1},
+	"colorchannelmixer": {keys: []string{"aa"}},
+	"overlay":           {keys: []string{"x", "y", "shortest", "enable"}},
+	"hstack":            {keys: []string{"inputs"}},
+	"vstack":            {keys: []string{"inputs"}},
+	"concat":            {keys: []string{"n", "v"}},
+	"split":             {},
+	"reverse":           {},
+	"setpts":            {positional: 1},
+	"fps":               {positional: 1},
+	"drawgrid":          {keys: []string{"w", "h", "t", "c"}},
+	"tile":              {positional: 1, keys: []string{"padding", "margin"}},
+	"null":              {},
+	// used to find scene cuts.
+	"select":   {positional: 1},
+	"metadata": {positional: 1, keys: []string{"file"}},
+}
+
+// filterName matches the name of a filter, instance names (e.g. drawtext@foo) are not used so are not allowed.
+var filterName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// optionKey matches the name of a filter option at the start of the options.
+var optionKey = regexp.MustCompile(`^([a-zA-Z0-9_./-]+)=`)
+
+const filterWhitespace = " \n\t\r"
+
+// validateCommand checks a command received from a client only uses the inputs, options and filters the
+// renderer itself creates. This prevents a client reading or writing arbitrary files on the worker.
+func validateCommand(cmd Command) error {
+	for _, in := range cmd.Inputs {
+		// inputs must stay within the worker's media dir.
+		if !filepath.IsLocal(in.Path) {
+			return fmt.Errorf("invalid input path: %s", in.Path)
+		}
+		if err := validateArgs(in.Args, allowedInputArgs, nil); err != nil {
+			return fmt.Errorf("invalid input args: %w", err)
+		}
+	}
+	if err := validateArgs(cmd.OutputArgs, allowedOutputArgs, allowedOutputFlags); err != nil {
+		return fmt.Errorf("invalid output args: %w", err)
+	}
+	filters, err := parseFilterGraph(cmd.FilterGraph)
+	if err != nil {
+		return err
+	}
+	for _, filter := range filters {
+		if err := validateFilter(filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateArgs checks the args are allowed flags or pairs of allowed options and values. Since every value must
+// follow an option there is no way to add another output file.
+func validateArgs(args []string, allowed map[string][]string, flags []string) error {
+	for i := 0; i < len(args); i++ {
+		if slices.Contains(flags, args[i]) {
+			continue
+		}
+		values, ok := allowed[args[i]]
+		if !ok {
+			return fmt.Errorf("option is not allowed: %s", args[i])
+		}
+		if i+1 >= len(args) {
+			return fmt.Errorf("%s has no value", args[i])
+		}
+		option, value := args[i], args[i+1]
+		i++
+		if values == nil {
+			if !numericArg.MatchString(value) {
+				return fmt.Errorf("%s must be numeric: %s", option, value)
+			}
+			continue
+		}
+		if !slices.Contains(values, value) {
+			return fmt.Errorf("value is not allowed for %s: %s", option, value)
+		}
+	}
+	return nil
+}
+
+type parsedFilter struct {
+	name string
+	// args are the filter's options after the graph level quotes and escapes have been removed.
+	args string
+}
+
+// parseFilterGraph splits the graph into filters the same way ffmpeg does. Labels are discarded.
+func parseFilterGraph(graph string) ([]parsedFilter, error) {
+	filters := []parsedFilter{}
+	rest := graph
+	for {
+		var err error
+		if rest, err = skipLabels(rest); err != nil {
+			return nil, err
+		}
+		if rest == "" {
+			return filters, nil
+		}
+		filter := parsedFilter{}
+		filter.name, rest = getToken(rest, "=,;[")
+		if strings.HasPrefix(rest, "=") {
+			filter.args, rest = getToken(rest[1:], "[],;")
+		}
+		filters = append(filters, filter)
+
+		if rest, err = skipLabels(rest); err != nil {
+			return nil, err
+		}
+		if rest == "" {
+			return filters, nil
+		}
+		if rest[0] != ',' && rest[0] != ';' {
+			return nil, fmt.Errorf("invalid filter graph near: %s", rest)
+		}
+		rest = rest[1:]
+	}
+}
+
+// skipLabels removes any [labels] (and whitespace) from the start of the string.
+func skipLabels(s string) (string, error) {
+	s = strings.TrimLeft(s, filterWhitespace)
+	for strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end == -1 {
+			return "", fmt.Errorf("unterminated filter label: %s", s)
+		}
+		s = strings.TrimLeft(s[end+1:], filterWhitespace)
+	}
+	return s, nil
+}
+
+// validateFilter checks the filter is allowed and only uses allowed options.
+func validateFilter(filter parsedFilter) error {
+	spec, ok := allowedFilters[filter.name]
+	if !ok || !filterName.MatchString(filter.name) {
+		return fmt.Errorf("filter is not allowed: %s", filter.name)
+	}
+	rest := filter.args
+	for k := 0; rest != ""; k++ {
+		var key, value string
+		if match := optionKey.FindStringSubmatch(rest); match != nil {
+			key = match[1]
+			value, rest = getToken(rest[len(match[0]):], ":")
+		} else {
+			// options may be given without a name but only before any named options.
+			if k >= spec.positional {
+				return fmt.Errorf("%s option is not allowed: %s", filter.name, rest)
+			}
+			value, rest = getToken(rest, ":")
+		}
+		rest = strings.TrimPrefix(rest, ":")
+		if key == "" {
+			continue
+		}
+		if !slices.Contains(spec.keys, key) {
+			return fmt.Errorf("%s option is not allowed: %s", filter.name, key)
+		}
+		if err := validateFileOption(filter.name, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFileOption checks options that reference a file only use the files the renderer itself would.
+func validateFileOption(filter string, key string, value string) error {
+	switch {
+	case filter == "drawtext" && key == "fontfile":
+		if !filepath.IsLocal(value) || !strings.HasPrefix(value, "assets/") {
+			return fmt.Errorf("font is not allowed: %s", value)
+		}
+	case filter == "metadata" && key == "file":
+		// metadata=print:file=- is used to write to stdout.
+		if value != "-" {
+			return fmt.Errorf("metadata file is not allowed: %s", value)
+		}
+	}
+	return nil
+}
+
+// getToken reads up to the first unquoted and unescaped terminator, removing the quotes and escapes. This works
+// like ffmpeg's av_get_token so the result is the same as ffmpeg would see.
+func getToken(s string, terminators string) (string, string) {
+	s = strings.TrimLeft(s, filterWhitespace)
+	token := strings.Builder{}
+	// trailing whitespace is removed unless it was quoted or escaped.
+	keep := 0
+	i := 0
+	for ; i < len(s) && !strings.ContainsRune(terminators, rune(s[i])); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				token.WriteByte(s[i])
+			}
+			keep = token.Len()
+		case '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end == -1 {
+				end = len(s) - i - 1
+			}
+			token.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			keep = token.Len()
+		default:
+			token.WriteByte(s[i])
+		}
+	}
+	result := token.String()
+	trimmed := strings.TrimRight(result[keep:], filterWhitespace)
+	return result[:keep] + trimmed, s[min(i, len(s)):]
+}
@@ -0,0 +1,107 @@
+package render
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidateCommand(t *testing.T) {
+	input := []Input{{Args: []string{"-ss", "1.00", "-to", "2.00"}, Path: "simpsons-S01E02.webm"}}
+	tests := []struct {
+		name    string
+		cmd     Command
+		wantErr bool
+	}{
+		{
+			name: "font from assets",
+			cmd:  Command{Inputs: input, FilterGraph: "[0:v]drawtext=fontfile='assets/akbar.ttf':text='Hello'"},
+		},
+		{
+			name: "dialog looks like a filter",
+			cmd:  Command{Inputs: input, FilterGraph: "[0:v]drawtext=text='let’s see a, movie=/etc/passwd textfile=x'"},
+		},
+		{
+			name: "metadata to stdout",
+			cmd:  Command{Inputs: input, FilterGraph: "[0:v]select='gt(scene,0.30)',metadata=print:file=-", OutputArgs: []string{"-f", "null"}},
+		},
+		{
+			name: "output without audio",
+			cmd:  Command{Inputs: input, OutputArgs: []string{"-f", "webm", "-an"}},
+		},
+		{
+			name:    "output option without value",
+			cmd:     Command{Inputs: input, OutputArgs: []string{"-f", "webm", "-ss"}},
+			wantErr: true,
+		},
+		{
+			name:    "font outside assets",
+			cmd:     Command{Inputs: input, FilterGraph: "[0:v]drawtext=fontfile='/etc/passwd':text='Hello'"},
+			wantErr: true,
+		},
+		{
+			name:    "metadata to file",
+			cmd:     Command{Inputs: input, FilterGraph: "[0:v]metadata=print:file=/tmp/out"},
+			wantErr: true,
+		},
+		{
+			name:    "vidstabdetect writes a file",
+			cmd:     Command{Inputs: input, FilterGraph: "[0:v]vidstabdetect=result=/tmp/x"},
+			wantErr: true,
+		},
+		{
+			name:    "cover_rect reads a file",
+			cmd:     Command{Inputs: input, FilterGraph: "[0:v]cover_rect=cover=/etc/passwd"},
+			wantErr: true,
+		},
+		{
+			name:    "find_rect reads a file",
+			cmd:     Command{Inputs: input, FilterGraph: "[0:v]find_rect=object=/etc/passwd"},
+			wantErr: true,
+		},
+		{
+			name:    "removelogo short file option",
+			cmd:     Command{Inputs: input, FilterGraph: "[0:v]removelogo=f=/etc/passwd"},
+			wantErr: true,
+		},
+		{
+			name:    "frei0r loads a library",
+			cmd:     Command{Inputs: input, FilterGraph: "[0:v]frei0r=filter_name=/tmp/x.so"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown drawtext option",
+			cmd:     Command{Inputs: input, FilterGraph: "[0:v]drawtext=textfile=/etc/passwd"},
+			wantErr: true,
+		},
+		{
+			name:    "option hidden in quotes",
+			cmd:     Command{Inputs: input, FilterGraph: "[0:v]drawtext=text='x:fontfile=/etc/passwd'"},
+			wantErr: true,
+		},
+		{
+			name:    "filter instance name",
+			cmd:     Command{Inputs: input, FilterGraph: "[0:v]drawtext@x=text='x'"},
+			wantErr: true,
+		},
+		{
+			name:    "lavfi input",
+			cmd:     Command{Inputs: []Input{{Args: []string{"-f", "lavfi"}, Path: "movie=x"}}},
+			wantErr: true,
+		},
+		{
+			name:    "non-numeric seek",
+			cmd:     Command{Inputs: []Input{{Args: []string{"-ss", "1; rm"}, Path: "simpsons-S01E02.webm"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCommand(tt.cmd)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -64,6 +64,7 @@ func DocumentsFromModel(episode *model.Episode) []searchModel.DialogDocument {
 			ID:               fmt.Sprintf("%s-%d", episode.ID(), v.Pos),
 			Pos:              int32(v.Pos),
 			EpisodeID:        episode.ID(),
+			EpisodeTitle:     episode.Title,
 			Publication:      episode.Publication,
 			PublicationGroup: episode.PublicationGroup,
 			Series:           episode.Series,
@@ -72,6 +73,7 @@ func DocumentsFromModel(episode *model.Episode) []searchModel.DialogDocument {
 			EndTimestamp:     v.EndTimestamp.Milliseconds(),
 			VideoFileName:    episode.VideoFile,
 			Content:          v.Content,
+			AirDate:          episode.AirDate,
 		})
 	}
 	return docs
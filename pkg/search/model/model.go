@@ -11,6 +11,7 @@ type DialogDocument struct {
 	ID               string `json:"id"`
 	Pos              int32  `json:"pos"`
 	EpisodeID        string `json:"episode_id"`
+	EpisodeTitle     string `json:"episode_title"`
 	Publication      string `json:"publication"`
 	PublicationGroup string `json:"publication_group"`
 	Series           int32  `json:"series"`
@@ -19,9 +20,15 @@ type DialogDocument struct {
 	EndTimestamp     int64  `json:"end_timestamp"`
 	VideoFileName    string `json:"video_file_name"`
 	Content          string `json:"content"`
+	// AirDate is only set if the episode had metadata.
+	AirDate *time.Time `json:"air_date,omitempty"`
 }
 
+// ShortEpisodeID e.g. S01E02. Films have no series or episode so this is empty.
 func (d *DialogDocument) ShortEpisodeID() string {
+	if d.Series == 0 && d.Episode == 0 {
+		return ""
+	}
 	return util.FormatSeriesAndEpisode(int(d.Series), int(d.Episode))
 }
 
@@ -30,6 +37,7 @@ func (d *DialogDocument) FieldMapping() map[string]mapping.FieldType {
 		"_id":               mapping.FieldTypeKeyword,
 		"pos":               mapping.FieldTypeNumber,
 		"episode_id":        mapping.FieldTypeKeyword,
+		"episode_title":     mapping.FieldTypeKeyword,
 		"publication":       mapping.FieldTypeKeyword,
 		"publication_group": mapping.FieldTypeKeyword,
 		"series":            mapping.FieldTypeNumber,
@@ -38,6 +46,7 @@ func (d *DialogDocument) FieldMapping() map[string]mapping.FieldType {
 		"end_timestamp":     mapping.FieldTypeNumber,
 		"video_file_name":   mapping.FieldTypeText,
 		"content":           mapping.FieldTypeText,
+		"air_date":          mapping.FieldTypeDate,
 	}
 }
 
@@ -53,6 +62,8 @@ func (d *DialogDocument) GetNamedField(name string) any {
 		return d.Pos
 	case "episode_id":
 		return d.EpisodeID
+	case "episode_title":
+		return d.EpisodeTitle
 	case "publication":
 		return d.Publication
 	case "publication_group":
@@ -69,6 +80,8 @@ func (d *DialogDocument) GetNamedField(name string) any {
 		return d.VideoFileName
 	case "content":
 		return d.Content
+	case "air_date":
+		return d.AirDate
 	}
 	return ""
 }
@@ -81,6 +94,8 @@ func (d *DialogDocument) SetNamedField(name string, value any) {
 		d.Pos = int32(bytesToFloatOrZero(value))
 	case "episode_id":
 		d.EpisodeID = string(value.([]byte))
+	case "episode_title":
+		d.EpisodeTitle = string(value.([]byte))
 	case "publication":
 		d.Publication = string(value.([]byte))
 	case "publication_group":
@@ -97,6 +112,10 @@ func (d *DialogDocument) SetNamedField(name string, value any) {
 		d.VideoFileName = string(value.([]byte))
 	case "content":
 		d.Content = string(value.([]byte))
+	case "air_date":
+		if airDate, err := bluge.DecodeDateTime(value.([]byte)); err == nil {
+			d.AirDate = &airDate
+		}
 	}
 }
 
@@ -202,9 +202,10 @@ func scanDocument(match *search2.DocumentMatch) (*model.DialogDocument, error) {
 	err := match.VisitStoredFields(func(field string, value []byte) bool {
 
 		if field == "_id" {
-			parts := strings.Split(string(value), "-")
-			var err error
-			cur.Series, cur.Episode, err = util.ExtractSeriesAndEpisode(parts[1])
+			episodeID, _, err := util.SplitDialogID(string(value))
+			if err == nil {
+				_, cur.Series, cur.Episode, err = util.ParseEpisodeID(episodeID)
+			}
 			if err != nil {
 				innerErr = fmt.Errorf("failed to scan details from id %s: %w", string(value), err)
 				return false
@@ -86,6 +86,10 @@ func (j *BlugeQuery) condition(field string, op searchterms.CompOp, value search
 			q := bluge.NewNumericRangeQuery(float64(value.Value().(time.Duration).Milliseconds()), math.MaxFloat64)
 			q.SetField(field)
 			return q, nil
+		case searchterms.DateType:
+			q := bluge.NewDateRangeInclusiveQuery(value.Value().(time.Time), time.Time{}, false, false)
+			q.SetField(field)
+			return q, nil
 		case searchterms.StringType:
 			q := bluge.NewTermRangeQuery(stripQuotes(value.String()), "")
 			q.SetField(field)
@@ -103,6 +107,10 @@ func (j *BlugeQuery) condition(field string, op searchterms.CompOp, value search
 			q := bluge.NewNumericRangeQuery(0-math.MaxFloat64, float64(value.Value().(time.Duration).Milliseconds()))
 			q.SetField(field)
 			return q, nil
+		case searchterms.DateType:
+			q := bluge.NewDateRangeInclusiveQuery(time.Time{}, value.Value().(time.Time), false, false)
+			q.SetField(field)
+			return q, nil
 		case searchterms.StringType:
 			q := bluge.NewTermRangeQuery("", stripQuotes(value.String()))
 			q.SetField(field)
@@ -120,6 +128,10 @@ func (j *BlugeQuery) condition(field string, op searchterms.CompOp, value search
 			q := bluge.NewNumericRangeInclusiveQuery(float64(value.Value().(time.Duration).Milliseconds()), math.MaxFloat64, true, true)
 			q.SetField(field)
 			return q, nil
+		case searchterms.DateType:
+			q := bluge.NewDateRangeInclusiveQuery(value.Value().(time.Time), time.Time{}, true, false)
+			q.SetField(field)
+			return q, nil
 		case searchterms.StringType:
 			q := bluge.NewTermRangeInclusiveQuery(stripQuotes(value.String()), "", true, true)
 			q.SetField(field)
@@ -137,6 +149,10 @@ func (j *BlugeQuery) condition(field string, op searchterms.CompOp, value search
 			q := bluge.NewNumericRangeInclusiveQuery(0-math.MaxFloat64, float64(value.Value().(time.Duration).Milliseconds()), true, true)
 			q.SetField(field)
 			return q, nil
+		case searchterms.DateType:
+			q := bluge.NewDateRangeInclusiveQuery(time.Time{}, value.Value().(time.Time), false, true)
+			q.SetField(field)
+			return q, nil
 		case searchterms.StringType:
 			q := bluge.NewTermRangeInclusiveQuery("", stripQuotes(value.String()), true, true)
 			q.SetField(field)
@@ -182,16 +198,21 @@ func (j *BlugeQuery) eqFilter(field string, value searchterms.Value) (bluge.Quer
 				return nil, fmt.Errorf("cannot compare number to %s", value.Type())
 			}
 		case mapping.FieldTypeDate:
-			if v, ok := value.Value().(string); ok {
+			switch v := value.Value().(type) {
+			case time.Time:
+				q := bluge.NewDateRangeInclusiveQuery(v, v, true, true)
+				q.SetField(field)
+				return q, nil
+			case string:
 				ts, err := time.Parse(time.RFC3339, v)
 				if err != nil {
 					return nil, fmt.Errorf("failed to parse %s as date: %s", field, err.Error())
 				}
-				q := bluge.NewDateRangeQuery(ts, ts)
+				q := bluge.NewDateRangeInclusiveQuery(ts, ts, true, true)
 				q.SetField(field)
 				return q, nil
 			}
-			return nil, fmt.Errorf("non-string value given as date")
+			return nil, fmt.Errorf("cannot compare date to %s", value.Type())
 		}
 	}
 	return nil, fmt.Errorf("unknown field type %v", t)
@@ -150,6 +150,8 @@ func (p *parser) parseInner() ([]*Term, error) {
 			Value: Duration(ts),
 			Op:    CompOpGe,
 		}}, nil
+	case tagDateFilter:
+		return parseDateFilter(tok.lexeme)
 	case tagOffset:
 		offsetText, err := p.requireNext(tagInt, tagEOF)
 		if err != nil {
@@ -257,3 +259,69 @@ func (p *parser) expandIDCondition(lexme string) ([]*Term, error) {
 	}
 	return nil, fmt.Errorf("id had an unexpected format: %s", lexme)
 }
+
+// parseDateFilter converts filters like year:2005, aired:<2010 or aired:>=2005-06-01 into air date comparisons.
+// The date may be a year, month or day and is treated as the whole of that period e.g. aired:<=2005 includes
+// all of 2005.
+func parseDateFilter(lexeme string) ([]*Term, error) {
+	name, rawValue, _ := strings.Cut(lexeme, ":")
+	op, rawValue := cutCompOp(rawValue)
+
+	var start, end time.Time
+	var err error
+	switch strings.ToLower(name) {
+	case "year":
+		start, err = time.Parse("2006", rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("year was not valid (expected e.g. 2005): %s", rawValue)
+		}
+		end = start.AddDate(1, 0, 0)
+	case "aired":
+		start, end, err = parseDatePeriod(rawValue)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown date filter: %s", name)
+	}
+
+	switch op {
+	case CompOpLt:
+		return []*Term{{Field: []string{"air_date"}, Value: Date(start), Op: CompOpLt}}, nil
+	case CompOpLe:
+		return []*Term{{Field: []string{"air_date"}, Value: Date(end), Op: CompOpLt}}, nil
+	case CompOpGt:
+		return []*Term{{Field: []string{"air_date"}, Value: Date(end), Op: CompOpGe}}, nil
+	case CompOpGe:
+		return []*Term{{Field: []string{"air_date"}, Value: Date(start), Op: CompOpGe}}, nil
+	default:
+		return []*Term{
+			{Field: []string{"air_date"}, Value: Date(start), Op: CompOpGe},
+			{Field: []string{"air_date"}, Value: Date(end), Op: CompOpLt},
+		}, nil
+	}
+}
+
+// cutCompOp removes the comparison operator (if any) from the start of the value.
+func cutCompOp(raw string) (CompOp, string) {
+	for _, op := range []CompOp{CompOpLe, CompOpGe, CompOpLt, CompOpGt, CompOpEq} {
+		if after, ok := strings.CutPrefix(raw, string(op)); ok {
+			return op, after
+		}
+	}
+	return CompOpEq, raw
+}
+
+// parseDatePeriod parses a year, month or day e.g. 2005, 2005-06, 2005-06-01 into the period it covers.
+func parseDatePeriod(raw string) (time.Time, time.Time, error) {
+	if ts, err := time.Parse(time.DateOnly, raw); err == nil {
+		return ts, ts.AddDate(0, 0, 1), nil
+	}
+	if ts, err := time.Parse("2006-01", raw); err == nil {
+		return ts, ts.AddDate(0, 1, 0), nil
+	}
+	if ts, err := time.Parse("2006", raw); err == nil {
+		return ts, ts.AddDate(1, 0, 0), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("date was not valid (expected e.g. 2005, 2005-06 or 2005-06-01): %s", raw)
+}
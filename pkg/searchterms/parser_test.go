@@ -6,6 +6,14 @@ import (
 	"time"
 )
 
+func TestParseInvalidDateFilter(t *testing.T) {
+	for _, v := range []string{"year:05", "year:2005-06", "aired:06/2005", "aired:<"} {
+		if _, err := Parse(v); err == nil {
+			t.Errorf("Parse(%s) expected error", v)
+		}
+	}
+}
+
 func TestMustParse(t *testing.T) {
 	type args struct {
 		s string
@@ -88,6 +96,43 @@ func TestMustParse(t *testing.T) {
 				{Field: []string{"offset"}, Value: Int(20), Op: CompOpEq},
 			},
 		},
+		{
+			name: "parse year",
+			args: args{s: `year:2005`},
+			want: []Term{
+				{Field: []string{"air_date"}, Value: Date(time.Date(2005, 1, 1, 0, 0, 0, 0, time.UTC)), Op: CompOpGe},
+				{Field: []string{"air_date"}, Value: Date(time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC)), Op: CompOpLt},
+			},
+		},
+		{
+			name: "parse aired before",
+			args: args{s: `aired:<2010`},
+			want: []Term{
+				{Field: []string{"air_date"}, Value: Date(time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)), Op: CompOpLt},
+			},
+		},
+		{
+			name: "parse aired before or during",
+			args: args{s: `aired:<=2010-06`},
+			want: []Term{
+				{Field: []string{"air_date"}, Value: Date(time.Date(2010, 7, 1, 0, 0, 0, 0, time.UTC)), Op: CompOpLt},
+			},
+		},
+		{
+			name: "parse aired after",
+			args: args{s: `aired:>2010-06-01`},
+			want: []Term{
+				{Field: []string{"air_date"}, Value: Date(time.Date(2010, 6, 2, 0, 0, 0, 0, time.UTC)), Op: CompOpGe},
+			},
+		},
+		{
+			name: "parse year from",
+			args: args{s: `year:>=2005 man`},
+			want: []Term{
+				{Field: []string{"air_date"}, Value: Date(time.Date(2005, 1, 1, 0, 0, 0, 0, time.UTC)), Op: CompOpGe},
+				{Field: []string{"content"}, Value: String("man"), Op: CompOpFuzzyLike},
+			},
+		},
 		{
 			name: "parse all",
 			args: args{s: `@steve ~xfm #s1 +30m "man alive" karl >10`},
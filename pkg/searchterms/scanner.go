@@ -17,11 +17,15 @@ const (
 	tagTimestamp   = "+"
 	tagOffset      = ">"
 
+	tagDateFilter   = "DATE_FILTER"
 	tagQuotedString = "QUOTED_STRING"
 	tagWord         = "WORD"
 	tagInt          = "INT"
 )
 
+// dateFilterPrefixes start a date filter e.g. year:2005 or aired:<2010-06. The whole filter is a single token.
+var dateFilterPrefixes = []string{"year:", "aired:"}
+
 type token struct {
 	tag    tag
 	lexeme string
@@ -91,6 +95,9 @@ func (s *scanner) next() (token, error) {
 		if isStartOfNumber(r) {
 			return s.scanNumber(), nil
 		}
+		if s.atDateFilter() {
+			return s.scanDateFilter()
+		}
 		if isValidInputRune(r) {
 			return s.scanWord()
 		}
@@ -137,6 +144,23 @@ func (s *scanner) scanWord() (token, error) {
 	return s.emit(tagWord), nil
 }
 
+func (s *scanner) atDateFilter() bool {
+	remaining := strings.ToLower(string(s.input[s.offset:]))
+	for _, prefix := range dateFilterPrefixes {
+		if strings.HasPrefix(remaining, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scanner) scanDateFilter() (token, error) {
+	for !s.atEOF() && !isWhitespace(s.peekRune()) {
+		s.nextRune()
+	}
+	return s.emit(tagDateFilter), nil
+}
+
 func (s *scanner) scanNumber() token {
 	for !s.atEOF() && (isNumber(s.peekRune())) {
 		s.nextRune()
@@ -84,6 +84,19 @@ func TestScan(t *testing.T) {
 			want:    []token{{tag: tagOffset, lexeme: ">"}, {tag: tagInt, lexeme: "10"}, {tag: tagEOF}},
 			wantErr: false,
 		},
+		{
+			name: "scan date filters",
+			args: args{
+				str: `year:2005 foo aired:<=2010-06`,
+			},
+			want: []token{
+				{tag: tagDateFilter, lexeme: "year:2005"},
+				{tag: tagWord, lexeme: "foo"},
+				{tag: tagDateFilter, lexeme: "aired:<=2010-06"},
+				{tag: tagEOF},
+			},
+			wantErr: false,
+		},
 		{
 			name: "scan everything",
 			args: args{
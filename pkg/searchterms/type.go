@@ -6,6 +6,7 @@ const (
 	IntType      Type = "int"
 	StringType   Type = "string"
 	DurationType Type = "duration"
+	DateType     Type = "date"
 )
 
 func (t Type) Kind() Type {
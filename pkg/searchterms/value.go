@@ -67,3 +67,21 @@ func (s DurationValue) Value() interface{} {
 func (s DurationValue) String() string {
 	return time.Duration(s).String()
 }
+
+func Date(ts time.Time) DateValue {
+	return DateValue(ts)
+}
+
+type DateValue time.Time
+
+func (s DateValue) Type() Type {
+	return DateType
+}
+
+func (s DateValue) Value() interface{} {
+	return time.Time(s)
+}
+
+func (s DateValue) String() string {
+	return time.Time(s).Format(time.DateOnly)
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS "render_stats"
+(
+    "media_id"       TEXT PRIMARY KEY,
+    "renders"        INTEGER   NOT NULL DEFAULT 0,
+    "posts"          INTEGER   NOT NULL DEFAULT 0,
+    "last_requested" TIMESTAMP NOT NULL
+);
+
+CREATE INDEX render_stats_total ON render_stats ("renders", "posts");
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS "episode_offset"
+(
+    "publication" TEXT    NOT NULL,
+    "series"      INTEGER NOT NULL,
+    "episode"     INTEGER NOT NULL,
+    "time_offset" INTEGER NOT NULL DEFAULT 0,
+    "time_scale"  REAL    NOT NULL DEFAULT 1,
+    PRIMARY KEY ("publication", "series", "episode")
+);
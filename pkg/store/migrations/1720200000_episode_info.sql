@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS "episode_info"
+(
+    "publication" TEXT      NOT NULL,
+    "series"      INTEGER   NOT NULL,
+    "episode"     INTEGER   NOT NULL,
+    "title"       TEXT      NOT NULL DEFAULT '',
+    "air_date"    TIMESTAMP NULL,
+    "show_name"   TEXT      NOT NULL DEFAULT '',
+    PRIMARY KEY ("publication", "series", "episode")
+);
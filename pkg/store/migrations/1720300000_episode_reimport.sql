@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS "episode_reimport"
+(
+    "episode_id" TEXT NOT NULL PRIMARY KEY
+);
@@ -0,0 +1 @@
+ALTER TABLE "episode_info" ADD COLUMN "last_episode" INTEGER NOT NULL DEFAULT 0;
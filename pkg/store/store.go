@@ -3,6 +3,7 @@ package store
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/warmans/tvgif/pkg/model"
 	"github.com/warmans/tvgif/pkg/util"
@@ -53,7 +54,37 @@ func (s *SRTStore) ImportEpisode(m model.Episode) error {
 			return err
 		}
 	}
-	return nil
+	return s.SetEpisodeInfo(m.Info())
+}
+
+// SetEpisodeInfo replaces the descriptive information about the episode.
+func (s *SRTStore) SetEpisodeInfo(info model.EpisodeInfo) error {
+	_, err := s.conn.Exec(
+		`REPLACE INTO episode_info (publication, series, episode, last_episode, title, air_date, show_name) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		info.Publication,
+		info.Series,
+		info.Episode,
+		info.LastEpisode,
+		info.Title,
+		info.AirDate,
+		info.ShowName,
+	)
+	return err
+}
+
+// GetEpisodeInfo gets the descriptive information about the episode. If there is none it will be empty.
+func (s *SRTStore) GetEpisodeInfo(publication string, series int32, episode int32) (model.EpisodeInfo, error) {
+	info := model.EpisodeInfo{Publication: publication, Series: series, Episode: episode}
+	err := s.conn.QueryRowx(
+		`SELECT last_episode, title, air_date, show_name FROM episode_info WHERE publication=$1 AND series=$2 AND episode=$3`,
+		publication,
+		series,
+		episode,
+	).Scan(&info.LastEpisode, &info.Title, &info.AirDate, &info.ShowName)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return info, err
+	}
+	return info, nil
 }
 
 func (s *SRTStore) GetDialogRange(publication string, series int32, episode int32, startPos int64, endPos int64) ([]model.Dialog, error) {
@@ -130,7 +161,15 @@ func (s *SRTStore) GetDialogContext(publication string, series int32, episode in
 }
 
 func (s *SRTStore) ListPublications() ([]model.Publication, error) {
-	rows, err := s.conn.Queryx(`SELECT publication, COALESCE(publication_group, ''), GROUP_CONCAT(DISTINCT series) FROM dialog GROUP BY publication;`)
+	rows, err := s.conn.Queryx(`
+		SELECT 
+		    d.publication, 
+		    COALESCE(d.publication_group, ''), 
+		    GROUP_CONCAT(DISTINCT d.series),
+		    COALESCE((SELECT MAX(i.show_name) FROM episode_info i WHERE i.publication = d.publication), '')
+		FROM dialog d 
+		GROUP BY d.publication;
+	`)
 	if err != nil {
 		return nil, err
 	}
@@ -140,7 +179,7 @@ func (s *SRTStore) ListPublications() ([]model.Publication, error) {
 	for rows.Next() {
 		row := model.Publication{}
 		var series string
-		if err := rows.Scan(&row.Name, &row.Group, &series); err != nil {
+		if err := rows.Scan(&row.Name, &row.Group, &series, &row.DisplayName); err != nil {
 			return nil, err
 		}
 		row.Series = strings.Split(series, ",")
@@ -182,6 +221,20 @@ func (s *SRTStore) ManifestAdd(srtFilename string, srtModTime time.Time) (Upsert
 	return UpsertResultCreated, nil
 }
 
+// ManifestUnchanged checks if the file is already in the manifest with the given mod time i.e. ManifestAdd would be
+// a noop. The manifest is not modified.
+func (s *SRTStore) ManifestUnchanged(srtFilename string, srtModTime time.Time) (bool, error) {
+	var originalModTime *time.Time
+	err := s.conn.QueryRowx(`SELECT srt_mod_time FROM manifest WHERE srt_file = $1`, srtFilename).Scan(&originalModTime)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return originalModTime != nil && util.FromPtr(originalModTime).Equal(srtModTime), nil
+}
+
 func (s *SRTStore) GetManifest() (map[string]time.Time, error) {
 
 	results, err := s.conn.Queryx(`SELECT srt_file, srt_mod_time FROM manifest`)
@@ -205,3 +258,187 @@ func (s *SRTStore) GetManifest() (map[string]time.Time, error) {
 	}
 	return manifest, nil
 }
+
+// RecordRender increments the number of times a preview of the given media.ID has been rendered.
+func (s *SRTStore) RecordRender(mediaID string) error {
+	_, err := s.conn.Exec(
+		`
+		INSERT INTO render_stats (media_id, renders, posts, last_requested) VALUES ($1, 1, 0, $2)
+		ON CONFLICT DO UPDATE SET renders=renders+1, last_requested=$2
+		`,
+		mediaID,
+		time.Now(),
+	)
+	return err
+}
+
+// RecordPost increments the number of times the given media.ID has been posted.
+func (s *SRTStore) RecordPost(mediaID string) error {
+	_, err := s.conn.Exec(
+		`
+		INSERT INTO render_stats (media_id, renders, posts, last_requested) VALUES ($1, 0, 1, $2)
+		ON CONFLICT DO UPDATE SET posts=posts+1, last_requested=$2
+		`,
+		mediaID,
+		time.Now(),
+	)
+	return err
+}
+
+// ListMostRequested gets the media IDs with the highest combined render and post counts.
+func (s *SRTStore) ListMostRequested(limit int) ([]string, error) {
+	rows, err := s.conn.Queryx(
+		`SELECT media_id FROM render_stats ORDER BY (renders + posts) DESC, last_requested DESC LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// GetEpisodeOffset gets the offset for the episode. If none has been set the offset will have no effect.
+func (s *SRTStore) GetEpisodeOffset(publication string, series int32, episode int32) (model.EpisodeOffset, error) {
+	offset := model.EpisodeOffset{Publication: publication, Series: series, Episode: episode, Scale: 1}
+	err := s.conn.QueryRowx(
+		`SELECT time_offset, time_scale FROM episode_offset WHERE publication=$1 AND series=$2 AND episode=$3`,
+		publication,
+		series,
+		episode,
+	).Scan(&offset.Offset, &offset.Scale)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return offset, err
+	}
+	return offset, nil
+}
+
+// SetEpisodeOffset sets the correction for the episode's timestamps. The episode is queued to be re-imported
+// since the offset is applied during import.
+func (s *SRTStore) SetEpisodeOffset(offset model.EpisodeOffset) error {
+	_, err := s.conn.Exec(
+		`
+		INSERT INTO episode_offset (publication, series, episode, time_offset, time_scale) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO UPDATE SET time_offset=$4, time_scale=$5
+		`,
+		offset.Publication,
+		offset.Series,
+		offset.Episode,
+		offset.Offset,
+		offset.Scale,
+	)
+	if err != nil {
+		return err
+	}
+	return s.QueueReimport(offset.EpisodeID())
+}
+
+// RemoveEpisodeOffset removes the episode's correction and queues the episode to be re-imported without it.
+func (s *SRTStore) RemoveEpisodeOffset(publication string, series int32, episode int32) error {
+	_, err := s.conn.Exec(
+		`DELETE FROM episode_offset WHERE publication=$1 AND series=$2 AND episode=$3`,
+		publication,
+		series,
+		episode,
+	)
+	if err != nil {
+		return err
+	}
+	return s.QueueReimport(util.FormatEpisodeID(publication, series, episode))
+}
+
+// ShiftEpisodeDialog adds the shift to the timestamps of the episode's dialog already in the DB. It does not
+// update the metadata or search index so the episode should also be re-imported.
+func (s *SRTStore) ShiftEpisodeDialog(publication string, series int32, episode int32, shift time.Duration) error {
+	_, err := s.conn.Exec(
+		`
+		UPDATE dialog SET start_timestamp=MAX(start_timestamp + $4, 0), end_timestamp=MAX(end_timestamp + $4, 0)
+		WHERE publication=$1 AND series=$2 AND episode=$3
+		`,
+		publication,
+		series,
+		episode,
+		shift,
+	)
+	return err
+}
+
+// SaveEpisodeShift makes a shift of the episode's dialog permanent. The dialog already in the DB is shifted,
+// the shift is added to the episode's offset and the episode is queued to be re-imported with the new offset.
+// This is done in a single transaction so a re-import cannot see the shifted dialog without the offset.
+func (c *Conn) SaveEpisodeShift(publication string, series int32, episode int32, shift time.Duration) (model.EpisodeOffset, error) {
+	var offset model.EpisodeOffset
+	err := c.WithTx(func(tx *sqlx.Tx) error {
+		s := NewSRTStore(tx)
+		var err error
+		if offset, err = s.GetEpisodeOffset(publication, series, episode); err != nil {
+			return fmt.Errorf("failed to get existing offset: %w", err)
+		}
+		if err := s.ShiftEpisodeDialog(publication, series, episode, shift); err != nil {
+			return fmt.Errorf("failed to shift dialog: %w", err)
+		}
+		offset.Offset += shift
+		if err := s.SetEpisodeOffset(offset); err != nil {
+			return fmt.Errorf("failed to save offset: %w", err)
+		}
+		return nil
+	})
+	return offset, err
+}
+
+func (s *SRTStore) ListEpisodeOffsets() ([]model.EpisodeOffset, error) {
+	rows, err := s.conn.Queryx(`SELECT publication, series, episode, time_offset, time_scale FROM episode_offset ORDER BY publication, series, episode`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	offsets := []model.EpisodeOffset{}
+	for rows.Next() {
+		row := model.EpisodeOffset{}
+		if err := rows.StructScan(&row); err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, row)
+	}
+	return offsets, nil
+}
+
+// QueueReimport marks the episode to be re-imported from its SRT by the importer.
+func (s *SRTStore) QueueReimport(episodeID string) error {
+	_, err := s.conn.Exec(`INSERT INTO episode_reimport (episode_id) VALUES ($1) ON CONFLICT DO NOTHING`, episodeID)
+	return err
+}
+
+// ListQueuedReimports gets the IDs of the episodes waiting to be re-imported.
+func (s *SRTStore) ListQueuedReimports() ([]string, error) {
+	rows, err := s.conn.Queryx(`SELECT episode_id FROM episode_reimport ORDER BY episode_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	episodeIDs := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		episodeIDs = append(episodeIDs, id)
+	}
+	return episodeIDs, nil
+}
+
+func (s *SRTStore) RemoveQueuedReimport(episodeID string) error {
+	_, err := s.conn.Exec(`DELETE FROM episode_reimport WHERE episode_id=$1`, episodeID)
+	return err
+}
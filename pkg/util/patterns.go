@@ -6,3 +6,11 @@ var NameWithShortSeasonAndEpisode = regexp.MustCompile(`^.*[sS](?P<series>\d+)(\
 var NameWithLongSeasonAndEpisode = regexp.MustCompile(`^.*[sS](eason|eries) (?P<series>\d+) [eE]pisode (?P<episode>\d+).*$`)
 var NameWithSplitSeasonAndEpisode = regexp.MustCompile(`^.*[sS](?P<series>\d+)\.[eE](?P<episode>\d+).*$`)
 var ShortSeasonAndEpisode = regexp.MustCompile(`^\D*(?P<series>\d+)[xX](?P<episode>\d+)\D*$`)
+
+// SeasonAndEpisodePatterns are checked in order to find the season and episode in a file name.
+var SeasonAndEpisodePatterns = []*regexp.Regexp{
+	NameWithShortSeasonAndEpisode,
+	NameWithLongSeasonAndEpisode,
+	NameWithSplitSeasonAndEpisode,
+	ShortSeasonAndEpisode,
+}
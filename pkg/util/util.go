@@ -10,6 +10,7 @@ import (
 var punctuation = regexp.MustCompile(`[^a-zA-Z0-9\s]+`)
 var spaces = regexp.MustCompile(`[\s]{2,}`)
 var metaWhitespace = regexp.MustCompile(`[\n\r\t]+`)
+var seriesAndEpisodeRegex = regexp.MustCompile(`^S\d+E\d+$`)
 
 func TrimToN(line string, maxLength int) string {
 	if len(line) <= maxLength {
@@ -64,6 +65,16 @@ func ParseSeriesAndEpisodeFromFileName(filePatternRegex *regexp.Regexp, filename
 	return seriesInt, episodeInt, nil
 }
 
+// ParseSeriesAndEpisodeFromAnyFileName tries each of the SeasonAndEpisodePatterns in turn.
+func ParseSeriesAndEpisodeFromAnyFileName(filename string) (int64, int64, error) {
+	for _, re := range SeasonAndEpisodePatterns {
+		if re.MatchString(filename) {
+			return ParseSeriesAndEpisodeFromFileName(re, filename)
+		}
+	}
+	return 0, 0, fmt.Errorf("no pattern matched: %s", filename)
+}
+
 // ExtractSeriesAndEpisode e.g. S1E01
 func ExtractSeriesAndEpisode(raw string) (int32, int32, error) {
 	raw = strings.TrimPrefix(raw, "S")
@@ -86,6 +97,50 @@ func FormatSeriesAndEpisode(series int, episode int) string {
 	return fmt.Sprintf("S%02dE%02d", series, episode)
 }
 
+// FormatEpisodeID e.g. peepshow-S01E02. Films/one-offs have no series or episode so are identified
+// only by the publication.
+func FormatEpisodeID(publication string, series int32, episode int32) string {
+	if series == 0 && episode == 0 {
+		return publication
+	}
+	return fmt.Sprintf("%s-%s", publication, FormatSeriesAndEpisode(int(series), int(episode)))
+}
+
+// ParseEpisodeID parses IDs created by FormatEpisodeID. The publication may contain hyphens so the
+// series and episode are taken from the end of the ID.
+func ParseEpisodeID(raw string) (string, int32, int32, error) {
+	if publication, seriesAndEpisode, ok := cutLast(raw, "-"); ok && seriesAndEpisodeRegex.MatchString(seriesAndEpisode) {
+		series, episode, err := ExtractSeriesAndEpisode(seriesAndEpisode)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		if publication == "" {
+			return "", 0, 0, fmt.Errorf("episode ID %s has no publication", raw)
+		}
+		return publication, series, episode, nil
+	}
+	if raw == "" {
+		return "", 0, 0, fmt.Errorf("episode ID was empty")
+	}
+	return raw, 0, 0, nil
+}
+
+// SplitDialogID splits an ID like peepshow-S01E02-10 into the episode ID and the remainder.
+func SplitDialogID(raw string) (string, string, error) {
+	episodeID, suffix, ok := cutLast(raw, "-")
+	if !ok || episodeID == "" {
+		return "", "", fmt.Errorf("unrecognized dialog ID: %s", raw)
+	}
+	return episodeID, suffix, nil
+}
+
+func cutLast(s string, sep string) (string, string, bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
 func InStrings(s string, ss ...string) bool {
 	for _, v := range ss {
 		if s == v {
@@ -133,3 +188,14 @@ func IfElse[T comparable](cond bool, a T, b T) T {
 	}
 	return b
 }
+
+// SplitNonEmpty splits s by sep, trimming whitespace and discarding empty elements.
+func SplitNonEmpty(s string, sep string) []string {
+	out := []string{}
+	for _, v := range strings.Split(s, sep) {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
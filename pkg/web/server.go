@@ -1,6 +1,7 @@
 package web
 
 import (
+	"encoding/json"
 	"github.com/warmans/tvgif/pkg/mediacache"
 	"html/template"
 	"net/http"
@@ -10,11 +11,13 @@ func NewServer(
 	addr string,
 	overlayDir string,
 	overlayCache *mediacache.OverlayCache,
+	mediaCache *mediacache.Cache,
 ) *Server {
 	return &Server{
 		addr:         addr,
 		overlayDir:   overlayDir,
 		overlayCache: overlayCache,
+		mediaCache:   mediaCache,
 		template: template.Must(template.New("overlays").Parse(`<!doctype html>
 <html lang='en'>
 	<head>
@@ -48,7 +51,7 @@ func NewServer(
 		<main>
 			<table>
 				{{range .}}
-					<tr><td><img width="200px" src="/overlays/{{.}}" /></td><td><pre>{{.}}</pre></td></tr>
+					<tr><td><img width="200px" src="/overlays/{{.Name}}" /></td><td><pre>{{.Name}}</pre></td><td><pre>{{.Width}}x{{.Height}}{{if .Animated}} (animated){{end}}</pre></td><td><pre>{{.Category}} {{range .Tags}}#{{.}} {{end}}</pre></td></tr>
 				{{end}}
 			</table>
 		</main>
@@ -61,6 +64,7 @@ type Server struct {
 	addr         string
 	overlayDir   string
 	overlayCache *mediacache.OverlayCache
+	mediaCache   *mediacache.Cache
 	template     *template.Template
 }
 
@@ -70,9 +74,25 @@ func (s *Server) handleOverlays(resp http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (s *Server) handleOverlaySearch(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(resp).Encode(s.overlayCache.Search(req.URL.Query().Get("q"))); err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleCacheStats(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(resp).Encode(s.mediaCache.Stats()); err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/overlays/index.html", s.handleOverlays)
+	mux.HandleFunc("/overlays/search.json", s.handleOverlaySearch)
+	mux.HandleFunc("/cache/stats.json", s.handleCacheStats)
 	mux.Handle("/overlays/", http.StripPrefix("/overlays", http.FileServer(http.Dir(s.overlayDir))))
 
 	return http.ListenAndServe(s.addr, mux)